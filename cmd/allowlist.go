@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"path"
+	"strings"
+	"syscall"
+)
+
+// the pools that item urls may point to.  since pool requests carry a privileged
+// token, item urls are checked against this list before any request is made.
+type poolAllowlist struct {
+	entries      []poolAllowlistEntry
+	allowPrivate bool          // whether pools may live at private/loopback/link-local addresses
+	registry     *poolRegistry // the pools allowed when there are no entries
+}
+
+// an allowed pool, given either as a base url (scheme, host pattern, and path prefix),
+// or as just a host pattern.  host patterns are shell-style, e.g. "*.lib.virginia.edu"
+type poolAllowlistEntry struct {
+	pattern string // as configured
+	scheme  string
+	host    string
+	path    string
+}
+
+func newPoolAllowlist(patterns []string, allowPrivate bool) (*poolAllowlist, error) {
+	a := poolAllowlist{allowPrivate: allowPrivate}
+
+	for _, pattern := range patterns {
+		entry := poolAllowlistEntry{pattern: pattern}
+
+		if strings.Contains(pattern, "://") == true {
+			u, err := url.Parse(pattern)
+			if err != nil || u.Host == "" {
+				return nil, fmt.Errorf("invalid pool base url: [%s]", pattern)
+			}
+
+			entry.scheme = strings.ToLower(u.Scheme)
+			entry.host = strings.ToLower(u.Host)
+			entry.path = strings.TrimSuffix(u.Path, "/")
+		} else {
+			entry.host = strings.ToLower(pattern)
+		}
+
+		if _, err := path.Match(entry.host, ""); err != nil {
+			return nil, fmt.Errorf("invalid pool host pattern: [%s]", pattern)
+		}
+
+		a.entries = append(a.entries, entry)
+	}
+
+	return &a, nil
+}
+
+func (e poolAllowlistEntry) matches(u *url.URL) bool {
+	if e.scheme != "" && e.scheme != strings.ToLower(u.Scheme) {
+		return false
+	}
+
+	// patterns with a port must match the port too
+	host := strings.ToLower(u.Hostname())
+	if strings.Contains(e.host, ":") == true {
+		host = strings.ToLower(u.Host)
+	}
+
+	if ok, _ := path.Match(e.host, host); ok == false {
+		return false
+	}
+
+	if e.path != "" && pathHasPrefix(u.Path, e.path) == false {
+		return false
+	}
+
+	return true
+}
+
+// whether a (decoded) url path is within a base path.  paths with dot segments, including
+// percent-encoded ones, are never within it, since pools may resolve them to somewhere else.
+func pathHasPrefix(urlPath, prefix string) bool {
+	for _, segment := range strings.FieldsFunc(urlPath, func(r rune) bool { return r == '/' || r == '\\' }) {
+		if segment == "." || segment == ".." {
+			return false
+		}
+	}
+
+	return urlPath == prefix || strings.HasPrefix(urlPath, prefix+"/")
+}
+
+// returns the allowlist entry an item url matches, if any
+func (a *poolAllowlist) match(u *url.URL) *poolAllowlistEntry {
+	for i := range a.entries {
+		if a.entries[i].matches(u) == true {
+			return &a.entries[i]
+		}
+	}
+
+	return nil
+}
+
+func (a *poolAllowlist) check(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("invalid url")
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("unsupported url scheme: [%s]", u.Scheme)
+	}
+
+	if u.User != nil {
+		return fmt.Errorf("url may not contain credentials")
+	}
+
+	// an empty allowlist allows only the pools in the pool registry, if any
+	allowed := len(a.entries) == 0 && a.registry.lookup(rawURL) != nil
+
+	if allowed == false && a.match(u) == nil {
+		return fmt.Errorf("url does not point to an allowed pool")
+	}
+
+	// host names are checked again when connecting (see dialControl), which
+	// also covers names that resolve to private addresses
+	if a.allowPrivate == false {
+		if u.Hostname() == "localhost" || strings.HasSuffix(u.Hostname(), ".localhost") {
+			return fmt.Errorf("url points to a private address")
+		}
+
+		if ip := net.ParseIP(u.Hostname()); ip != nil && isPrivateAddress(ip) == true {
+			return fmt.Errorf("url points to a private address")
+		}
+	}
+
+	return nil
+}
+
+// a pool request refused by the allowlist (e.g. on a redirect, or when connecting),
+// which says nothing about whether the pool itself is up
+type poolPolicyError struct {
+	err error
+}
+
+func (e poolPolicyError) Error() string {
+	return e.err.Error()
+}
+
+func (e poolPolicyError) Unwrap() error {
+	return e.err
+}
+
+// used as the pool dialer's Control function, so that the address actually being
+// connected to is checked, after any dns resolution and redirects
+func (a *poolAllowlist) dialControl(network, address string, c syscall.RawConn) error {
+	if a.allowPrivate == true {
+		return nil
+	}
+
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+
+	if ip := net.ParseIP(host); ip == nil || isPrivateAddress(ip) == true {
+		return poolPolicyError{fmt.Errorf("connection to private address %s is not allowed", host)}
+	}
+
+	return nil
+}
+
+func isPrivateAddress(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsUnspecified()
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/uvalib/virgo4-jwt/v4jwt"
+)
+
+// policies for callers that do not present a token
+const (
+	anonymousGuest = "guest" // pools are queried as a guest
+	anonymousUVA   = "uva"   // pools are queried as a UVA user, exposing protected citation info
+	anonymousDeny  = "deny"  // callers must present a valid token
+)
+
+func (p *serviceContext) initAuth() {
+	policy := p.config.JWT.Anonymous
+	if policy == "" {
+		policy = anonymousGuest
+	}
+
+	var claims v4jwt.V4Claims
+
+	switch policy {
+	case anonymousGuest, anonymousDeny:
+		claims = v4jwt.V4Claims{UserID: "anonymous", Role: v4jwt.Guest, AuthMethod: v4jwt.NoAuth}
+
+	case anonymousUVA:
+		claims = v4jwt.V4Claims{IsUVA: true}
+
+	default:
+		log.Printf("invalid anonymous policy: [%s]", policy)
+		os.Exit(1)
+	}
+
+	p.auth = serviceAuth{
+		anonymous: policy,
+		claims:    claims,
+	}
+
+	log.Printf("[AUTH] anonymous policy = %s", p.auth.anonymous)
+}
+
+func getBearerToken(authorization string) (string, error) {
+	components := strings.Fields(authorization)
+
+	if len(components) != 2 || components[0] != "Bearer" {
+		return "", errors.New("invalid authorization header")
+	}
+
+	return components[1], nil
+}
+
+func (p *serviceContext) authenticateHandler(c *gin.Context) {
+	// tokens are optional; when present, they must be valid
+
+	authorization := c.GetHeader("Authorization")
+
+	if authorization == "" {
+		if p.auth.anonymous == anonymousDeny {
+			p.authError(c, errors.New("authorization required"))
+		}
+
+		return
+	}
+
+	token, err := getBearerToken(authorization)
+	if err != nil {
+		p.authError(c, err)
+		return
+	}
+
+	claims, err := v4jwt.Validate(token, p.config.JWT.Key)
+	if err != nil {
+		p.authError(c, errors.New("invalid or expired token"))
+		return
+	}
+
+	c.Set("claims", claims)
+}
+
+func (p *serviceContext) authError(c *gin.Context, err error) {
+	cl := clientContext{}
+	cl.init(p, c)
+
+	cl.logRequest()
+
+	p.requestError(&cl, http.StatusUnauthorized, err)
+
+	c.Abort()
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// the outcome of generating a citation for a single item in a batch
+type batchResult struct {
+	item     string
+	pool     string
+	citation citationType
+	contents string
+	resp     serviceResponse
+}
+
+type batchItemResp struct {
+	Item  string `json:"item"`
+	Pool  string `json:"pool,omitempty"`
+	Label string `json:"label,omitempty"`
+	Value string `json:"value,omitempty"`
+	Code  string `json:"code,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+func (p *serviceContext) batchHandler(c *gin.Context) {
+	cl := clientContext{}
+	cl.init(p, c)
+
+	cl.logRequest()
+
+	name := c.Param("style")
+
+	style, ok := citationStyles[name]
+	if ok == false {
+		p.requestError(&cl, http.StatusBadRequest, fmt.Errorf("unknown citation style: [%s]", name))
+		return
+	}
+
+	var items []string
+	if err := c.ShouldBindJSON(&items); err != nil {
+		p.requestError(&cl, http.StatusBadRequest, fmt.Errorf("invalid batch request: %s", err.Error()))
+		return
+	}
+
+	if len(items) == 0 {
+		p.requestError(&cl, http.StatusBadRequest, fmt.Errorf("no items in batch request"))
+		return
+	}
+
+	if len(items) > p.batch.maxItems {
+		p.requestError(&cl, http.StatusRequestEntityTooLarge, fmt.Errorf("too many items in batch request: %d (maximum is %d)", len(items), p.batch.maxItems))
+		return
+	}
+
+	// make sure the style can actually be created before doing any work
+	citation, err := style.encoder(p, c)
+	if err != nil {
+		p.requestError(&cl, http.StatusBadRequest, err)
+		return
+	}
+
+	cl.styles = []string{citation.Label()}
+
+	results := p.batchCitations(&cl, style, items)
+
+	// combined file output, unless json was requested or the format cannot be combined
+
+	if style.concat == true && boolOptionWithFallback(c.Query("json"), false) == false {
+		p.serveBatchFile(&cl, results)
+		return
+	}
+
+	p.serveBatchJSON(&cl, results)
+}
+
+func (p *serviceContext) batchCitations(cl *clientContext, style citationStyle, items []string) []batchResult {
+	results := make([]batchResult, len(items))
+
+	workers := p.batch.workers
+	if workers > len(items) {
+		workers = len(items)
+	}
+
+	jobs := make(chan int)
+
+	var wg sync.WaitGroup
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for i := range jobs {
+				results[i] = p.batchCitation(cl, style, items[i])
+			}
+		}()
+	}
+
+	for i := range items {
+		jobs <- i
+	}
+
+	close(jobs)
+
+	wg.Wait()
+
+	return results
+}
+
+func (p *serviceContext) batchCitation(cl *clientContext, style citationStyle, item string) batchResult {
+	res := batchResult{item: item}
+
+	citation, err := style.encoder(p, cl.ginCtx)
+	if err != nil {
+		res.resp = serviceResponse{status: http.StatusBadRequest, err: err}
+		return res
+	}
+
+	s := citationsContext{}
+	s.initWithURL(p, cl, item)
+
+	if s.pool != nil {
+		res.pool = s.pool.id
+	}
+
+	if res.resp = s.handleCitationRequest([]citationType{citation}); res.resp.err != nil {
+		s.warn("batch item %s failed: %s", item, res.resp.err.Error())
+		return res
+	}
+
+	if res.contents, err = s.getContents(citation); err != nil {
+		s.warn("batch item %s failed: %s", item, err.Error())
+		res.resp = serviceResponse{status: http.StatusInternalServerError, err: err}
+		return res
+	}
+
+	res.citation = citation
+
+	return res
+}
+
+func (p *serviceContext) uniqueBatchKeys(cl *clientContext, results []batchResult) {
+	// bibtex and biblatex keys are derived from the records, so different items can
+	// end up with the same key, which would break the combined file
+	var entries []bibtexKeyedEntry
+	var indexes []int
+
+	for i := range results {
+		if entry, ok := results[i].citation.(bibtexKeyedEntry); ok == true && results[i].resp.err == nil {
+			entries = append(entries, entry)
+			indexes = append(indexes, i)
+		}
+	}
+
+	for _, n := range uniqueBibtexKeys(entries) {
+		res := &results[indexes[n]]
+
+		contents, err := res.citation.Contents()
+		if err != nil {
+			cl.warn("batch item %s failed: %s", res.item, err.Error())
+			res.resp = serviceResponse{status: http.StatusInternalServerError, err: err}
+			continue
+		}
+
+		res.contents = contents
+	}
+}
+
+func (p *serviceContext) serveBatchFile(cl *clientContext, results []batchResult) {
+	p.uniqueBatchKeys(cl, results)
+
+	var b strings.Builder
+	var first *batchResult
+	var failed []batchResult
+
+	for i := range results {
+		res := &results[i]
+
+		if res.resp.err != nil {
+			failed = append(failed, *res)
+			continue
+		}
+
+		if first == nil {
+			first = res
+		}
+
+		b.WriteString(res.contents)
+
+		// keep records separated
+		if strings.HasSuffix(res.contents, "\n") == false {
+			b.WriteString("\n")
+		}
+	}
+
+	// nothing to combine; report the first failure
+	if first == nil {
+		p.requestError(cl, failed[0].resp.status, failed[0].resp.err)
+		return
+	}
+
+	cl.logResponse(serviceResponse{status: http.StatusOK})
+
+	// the file has no room for errors, so clients are told which items are missing from it
+	if len(failed) > 0 {
+		cl.warn("batch file omits %d of %d item(s) due to errors", len(failed), len(results))
+
+		for _, res := range failed {
+			cl.ginCtx.Writer.Header().Add("X-Virgo-Failed-Item", res.item)
+		}
+	}
+
+	data := b.String()
+	fileName := "citations" + path.Ext(first.citation.FileName())
+
+	extraHeaders := map[string]string{
+		"Content-Disposition": fmt.Sprintf(`attachment; filename="%s"`, fileName),
+	}
+
+	cl.ginCtx.DataFromReader(http.StatusOK, int64(len(data)), first.citation.ContentType(), strings.NewReader(data), extraHeaders)
+}
+
+func (p *serviceContext) serveBatchJSON(cl *clientContext, results []batchResult) {
+	resp := []batchItemResp{}
+
+	for _, res := range results {
+		item := batchItemResp{Item: res.item, Pool: res.pool}
+
+		if res.resp.err != nil {
+			item.Code = res.resp.errorCode()
+			item.Error = res.resp.err.Error()
+		} else {
+			item.Label = res.citation.Label()
+			item.Value = res.contents
+		}
+
+		resp = append(resp, item)
+	}
+
+	cl.logResponse(serviceResponse{status: http.StatusOK})
+
+	cl.ginCtx.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"errors"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestUniqueBibtexKeys(t *testing.T) {
+	tests := []struct {
+		keys []string
+		want []string
+	}{
+		{[]string{"smith2020history", "jones2019atlas"}, []string{"smith2020history", "jones2019atlas"}},
+		{[]string{"smith2020history", "smith2020history"}, []string{"smith2020historya", "smith2020historyb"}},
+		{[]string{"smith2020history", "jones2019atlas", "smith2020history", "smith2020history"}, []string{"smith2020historya", "jones2019atlas", "smith2020historyb", "smith2020historyc"}},
+		{[]string{"smith2020history", "smith2020historya", "smith2020history"}, []string{"smith2020historyb", "smith2020historya", "smith2020historyc"}},
+	}
+
+	for _, test := range tests {
+		var entries []bibtexKeyedEntry
+
+		for _, key := range test.keys {
+			entries = append(entries, &bibtexEncoder{key: key})
+		}
+
+		uniqueBibtexKeys(entries)
+
+		for i, entry := range entries {
+			if entry.citationKey() != test.want[i] {
+				t.Errorf("keys %v: key %d = %q, want %q", test.keys, i, entry.citationKey(), test.want[i])
+			}
+		}
+	}
+
+	if suffix := bibtexKeySuffix(26); suffix != "aa" {
+		t.Errorf("bibtexKeySuffix(26) = %q, want \"aa\"", suffix)
+	}
+}
+
+func TestServeBatchFile(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	p := &serviceContext{randomSource: rand.New(rand.NewSource(1))}
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("POST", "/format/bibtex/batch", nil)
+
+	cl := clientContext{}
+	cl.init(p, c)
+
+	var results []batchResult
+
+	for _, item := range []string{"https://pool.example.org/api/resource/u1", "https://pool.example.org/api/resource/u2"} {
+		e := newBibtexEncoder(serviceConfigFormat{Extension: "bib"})
+		e.Init(&cl, item)
+
+		err := e.Populate(citationParts{
+			"format":         {"book"},
+			"title":          {"A History of Virginia"},
+			"author":         {"Smith, Jane"},
+			"published_date": {"2020"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		contents, _ := e.Contents()
+		results = append(results, batchResult{item: item, citation: e, contents: contents})
+	}
+
+	failedItem := "https://pool.example.org/api/resource/u3"
+	results = append(results, batchResult{item: failedItem, resp: serviceResponse{status: http.StatusNotFound, err: errors.New("item not found")}})
+
+	p.serveBatchFile(&cl, results)
+
+	keys := regexp.MustCompile(`(?m)^@book\{([^,]+),`).FindAllStringSubmatch(w.Body.String(), -1)
+
+	if len(keys) != 2 || keys[0][1] == keys[1][1] {
+		t.Errorf("expected two entries with distinct keys, got %v in:\n%s", keys, w.Body.String())
+	}
+
+	if failed := w.Header().Values("X-Virgo-Failed-Item"); len(failed) != 1 || failed[0] != failedItem {
+		t.Errorf("X-Virgo-Failed-Item = %v, want [%s]", failed, failedItem)
+	}
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// BibLaTeX entry types
+const biblatexTypeArticle = "article"
+const biblatexTypeArtwork = "artwork"
+const biblatexTypeAudio = "audio"
+const biblatexTypeBook = "book"
+const biblatexTypeMisc = "misc"
+const biblatexTypeMusic = "music"
+const biblatexTypeOnline = "online"
+const biblatexTypeReport = "report"
+const biblatexTypeThesis = "thesis"
+const biblatexTypeUnpublished = "unpublished"
+const biblatexTypeVideo = "video"
+
+// BibLaTeX thesis types (localization keys)
+const biblatexThesisMasters = "mathesis"
+const biblatexThesisPhd = "phdthesis"
+
+type biblatexEncoder struct {
+	cfg       serviceConfigFormat
+	url       string
+	entryType string
+	key       string
+	fields    bibtexFieldList
+	data      *genericCitation
+}
+
+var biblatexTypesMap map[string]string
+var biblatexHandleURL *regexp.Regexp
+
+func newBiblatexEncoder(cfg serviceConfigFormat) *biblatexEncoder {
+	e := biblatexEncoder{}
+
+	e.cfg = cfg
+	e.fields = newBibtexFieldList()
+
+	return &e
+}
+
+func (e *biblatexEncoder) Init(c *clientContext, url string) {
+	e.url = url
+}
+
+func (e *biblatexEncoder) Populate(parts citationParts) error {
+	var err error
+
+	if e.data, err = newRawCitation(e.url, parts); err != nil {
+		return err
+	}
+
+	isOnlineOnly := firstElementOf(parts["is_online_only"]) == "true"
+
+	e.entryType = biblatexEntryType(e.data.format, isOnlineOnly)
+	e.key = bibtexCitationKey(e.data, e.url)
+
+	// contributors, each in their own role
+	e.fields.addNames("author", e.data.authors)
+	e.fields.addNames("editor", e.data.editors)
+	e.fields.addNames("translator", e.data.translators)
+
+	if len(e.data.compilers) > 0 {
+		e.fields.addNames("editora", e.data.compilers)
+		e.fields.add("editoratype", "compiler")
+	}
+
+	// biblatex has no advisor role, so advisors are noted instead
+	if len(e.data.advisors) > 0 {
+		label := "Advisor"
+		if len(e.data.advisors) > 1 {
+			label = "Advisors"
+		}
+
+		e.fields.add("note", label+": "+strings.Join(e.data.advisors, "; "))
+	}
+
+	// biblatex keeps subtitles separate
+	e.fields.add("title", removeTrailingPeriods(firstElementOf(parts["title"])))
+	e.fields.add("subtitle", removeTrailingPeriods(firstElementOf(parts["subtitle"])))
+
+	switch e.data.format {
+	case "news":
+		e.fields.add("journaltitle", e.data.journal)
+		e.fields.add("entrysubtype", "newspaper")
+	case "article", "journal":
+		e.fields.add("journaltitle", e.data.journal)
+	default:
+		e.fields.add("series", firstElementOf(parts["series"]))
+	}
+
+	if e.entryType == biblatexTypeThesis {
+		e.fields.add("type", biblatexThesisType(parts))
+	}
+
+	e.fields.add("edition", cleanEndPunctuation(firstElementOf(parts["edition"])))
+	e.fields.add("volume", e.data.volume)
+	e.fields.add("number", e.data.issue)
+
+	pages := e.data.pageFrom
+	if e.data.pageTo != "" {
+		pages += "--" + e.data.pageTo
+	}
+	e.fields.add("pages", pages)
+
+	e.fields.add("date", isoDate(e.data.year, e.data.month, e.data.day))
+
+	// theses and reports name the granting/issuing institution, not the publisher
+	switch e.entryType {
+	case biblatexTypeThesis, biblatexTypeReport:
+		e.fields.add("institution", e.data.publisher)
+	default:
+		e.fields.add("publisher", e.data.publisher)
+	}
+
+	e.fields.add("location", cleanEndPunctuation(firstElementOf(parts["published_location"])))
+
+	e.fields.add(serialNumberKind(e.data.format), strings.Join(parts["serial_number"], ", "))
+
+	url := firstElementOf(parts["url"])
+
+	// prefer an explicit doi, but also accept one found in the url
+	doi := re.doiPrefix.ReplaceAllString(firstElementOf(parts["doi"]), "")
+	if doi == "" && re.doiURL.MatchString(url) == true {
+		doi = re.doiURL.ReplaceAllString(url, "")
+	}
+	e.fields.addVerbatim("doi", doi)
+
+	// handles are expressed as eprints
+	if groups := biblatexHandleURL.FindStringSubmatch(url); len(groups) > 1 {
+		e.fields.addVerbatim("eprint", groups[1])
+		e.fields.add("eprinttype", "hdl")
+	}
+
+	if url == "" {
+		url = e.url
+	}
+	e.fields.addVerbatim("url", url)
+
+	e.fields.add("language", firstElementOf(parts["language"]))
+	e.fields.add("keywords", strings.Join(parts["subject"], ", "))
+	e.fields.add("abstract", strings.Join(parts["abstract"], " "))
+
+	return nil
+}
+
+func (e *biblatexEncoder) Label() string {
+	return e.cfg.Label
+}
+
+func (e *biblatexEncoder) ContentType() string {
+	return e.cfg.ContentType
+}
+
+func (e *biblatexEncoder) FileName() string {
+	filename := itemName(e.url)
+
+	if e.cfg.Extension != "" {
+		filename += "." + e.cfg.Extension
+	}
+
+	return filename
+}
+
+func (e *biblatexEncoder) Contents() (string, error) {
+	return e.fields.entry(e.entryType, e.key), nil
+}
+
+func biblatexEntryType(format string, isOnlineOnly bool) string {
+	if entryType := biblatexTypesMap[format]; entryType != "" {
+		return entryType
+	}
+
+	// otherwise unclassified items that only exist online
+	if isOnlineOnly == true {
+		return biblatexTypeOnline
+	}
+
+	metrics.fallbackFormat("biblatex")
+
+	return biblatexTypeMisc
+}
+
+func biblatexThesisType(parts citationParts) string {
+	if isMastersThesis(parts) == true {
+		return biblatexThesisMasters
+	}
+
+	return biblatexThesisPhd
+}
+
+func init() {
+	// mapping of citation formats (citation part "format") to BibLaTeX entry type
+	biblatexTypesMap = make(map[string]string)
+
+	biblatexTypesMap["art"] = biblatexTypeArtwork
+	biblatexTypesMap["article"] = biblatexTypeArticle
+	biblatexTypesMap["book"] = biblatexTypeBook
+	biblatexTypesMap["government_document"] = biblatexTypeReport
+	biblatexTypesMap["journal"] = biblatexTypeArticle
+	biblatexTypesMap["manuscript"] = biblatexTypeUnpublished
+	biblatexTypesMap["music"] = biblatexTypeMusic
+	biblatexTypesMap["news"] = biblatexTypeArticle
+	biblatexTypesMap["sound"] = biblatexTypeAudio
+	biblatexTypesMap["thesis"] = biblatexTypeThesis
+	biblatexTypesMap["video"] = biblatexTypeVideo
+
+	biblatexHandleURL = regexp.MustCompile(`^https?://hdl\.handle\.net/(.+)$`)
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBiblatexAdvisors(t *testing.T) {
+	tests := []struct {
+		advisors []string
+		note     string
+	}{
+		{[]string{"Smith, Jane"}, "note = {Advisor: Smith, Jane}"},
+		{[]string{"Smith, Jane", "Jones, Sam"}, "note = {Advisors: Smith, Jane; Jones, Sam}"},
+	}
+
+	for _, test := range tests {
+		e := newBiblatexEncoder(serviceConfigFormat{})
+		e.Init(nil, "https://pool.example.org/api/resource/u1")
+
+		err := e.Populate(citationParts{
+			"format":  {"thesis"},
+			"title":   {"A Thesis"},
+			"author":  {"Doe, John"},
+			"advisor": test.advisors,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		contents, _ := e.Contents()
+
+		if strings.Contains(contents, test.note) == false {
+			t.Errorf("advisors %v: missing %q in:\n%s", test.advisors, test.note, contents)
+		}
+
+		if strings.Contains(contents, "editorb") == true {
+			t.Errorf("advisors %v: unexpected editorb field in:\n%s", test.advisors, contents)
+		}
+	}
+}
@@ -0,0 +1,441 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"unicode"
+
+	"github.com/microcosm-cc/bluemonday"
+	"golang.org/x/text/unicode/norm"
+)
+
+// BibTeX entry types
+const bibtexTypeArticle = "article"
+const bibtexTypeBook = "book"
+const bibtexTypeMastersThesis = "mastersthesis"
+const bibtexTypeMisc = "misc"
+const bibtexTypePhdThesis = "phdthesis"
+const bibtexTypeTechReport = "techreport"
+const bibtexTypeUnpublished = "unpublished"
+
+// misc definitions
+const bibtexLineEnding = "\n"
+const bibtexFieldFormat = "  %s = %s"
+
+type bibtexField struct {
+	name  string
+	value string
+}
+
+// ordered list of entry fields, shared by the BibTeX and BibLaTeX encoders
+type bibtexFieldList struct {
+	policy *bluemonday.Policy
+	fields []bibtexField
+}
+
+type bibtexEncoder struct {
+	cfg       serviceConfigFormat
+	url       string
+	entryType string
+	key       string
+	fields    bibtexFieldList
+	data      *genericCitation
+}
+
+var bibtexTypesMap map[string]string
+var bibtexMonths []string
+var bibtexEscapes *strings.Replacer
+
+func newBibtexEncoder(cfg serviceConfigFormat) *bibtexEncoder {
+	e := bibtexEncoder{}
+
+	e.cfg = cfg
+	e.fields = newBibtexFieldList()
+
+	return &e
+}
+
+func (e *bibtexEncoder) Init(c *clientContext, url string) {
+	e.url = url
+}
+
+func (e *bibtexEncoder) Populate(parts citationParts) error {
+	var err error
+
+	if e.data, err = newRawCitation(e.url, parts); err != nil {
+		return err
+	}
+
+	e.entryType = bibtexEntryType(e.data.format, parts)
+	e.key = bibtexCitationKey(e.data, e.url)
+
+	e.addNames("author", e.data.authors)
+	e.addNames("editor", e.data.editors)
+
+	e.addField("title", e.data.title)
+
+	switch e.entryType {
+	case bibtexTypeArticle:
+		e.addField("journal", e.data.journal)
+	default:
+		e.addField("series", firstElementOf(parts["series"]))
+	}
+
+	e.addField("edition", cleanEndPunctuation(firstElementOf(parts["edition"])))
+	e.addField("volume", e.data.volume)
+	e.addField("number", e.data.issue)
+
+	pages := e.data.pageFrom
+	if e.data.pageTo != "" {
+		pages += "--" + e.data.pageTo
+	}
+	e.addField("pages", pages)
+
+	if e.data.year != 0 {
+		e.addField("year", fmt.Sprintf("%d", e.data.year))
+	}
+
+	// month is a predefined macro, and so is not enclosed in braces
+	if e.data.month > 0 {
+		e.fields.addRaw("month", bibtexMonths[e.data.month-1])
+	}
+
+	// theses name the granting institution as the school, not the publisher
+	switch e.entryType {
+	case bibtexTypePhdThesis, bibtexTypeMastersThesis:
+		e.addField("school", e.data.publisher)
+	case bibtexTypeTechReport:
+		e.addField("institution", e.data.publisher)
+	default:
+		e.addField("publisher", e.data.publisher)
+	}
+
+	e.addField("address", cleanEndPunctuation(firstElementOf(parts["published_location"])))
+
+	e.addField(serialNumberKind(e.data.format), strings.Join(parts["serial_number"], ", "))
+
+	e.fields.addVerbatim("doi", re.doiPrefix.ReplaceAllString(firstElementOf(parts["doi"]), ""))
+
+	url := firstElementOf(parts["url"])
+	if url == "" {
+		url = e.url
+	}
+	e.fields.addVerbatim("url", url)
+
+	e.addField("language", firstElementOf(parts["language"]))
+	e.addField("keywords", strings.Join(parts["subject"], ", "))
+	e.addField("abstract", strings.Join(parts["abstract"], " "))
+
+	return nil
+}
+
+func (e *bibtexEncoder) addField(name, value string) {
+	e.fields.add(name, value)
+}
+
+func (e *bibtexEncoder) addNames(name string, values []string) {
+	e.fields.addNames(name, values)
+}
+
+func (e *bibtexEncoder) Label() string {
+	return e.cfg.Label
+}
+
+func (e *bibtexEncoder) ContentType() string {
+	return e.cfg.ContentType
+}
+
+func (e *bibtexEncoder) FileName() string {
+	filename := itemName(e.url)
+
+	if e.cfg.Extension != "" {
+		filename += "." + e.cfg.Extension
+	}
+
+	return filename
+}
+
+func (e *bibtexEncoder) Contents() (string, error) {
+	return e.fields.entry(e.entryType, e.key), nil
+}
+
+func newBibtexFieldList() bibtexFieldList {
+	return bibtexFieldList{policy: bluemonday.StrictPolicy()}
+}
+
+func (l *bibtexFieldList) cleanString(val string) string {
+	return plainText(l.policy, val)
+}
+
+func (l *bibtexFieldList) add(name, value string) {
+	cleaned := l.cleanString(value)
+
+	if cleaned == "" {
+		return
+	}
+
+	l.addRaw(name, "{"+bibtexEscape(cleaned)+"}")
+}
+
+// verbatim fields (urls, dois, eprints) are taken as-is by bibtex and biber, so they are not
+// escaped; only braces are percent-encoded, so that they cannot unbalance the entry
+var bibtexVerbatimEscapes = strings.NewReplacer("{", "%7B", "}", "%7D")
+
+func (l *bibtexFieldList) addVerbatim(name, value string) {
+	cleaned := l.cleanString(value)
+
+	if cleaned == "" {
+		return
+	}
+
+	l.addRaw(name, "{"+bibtexVerbatimEscapes.Replace(cleaned)+"}")
+}
+
+func (l *bibtexFieldList) addRaw(name, value string) {
+	l.fields = append(l.fields, bibtexField{name: name, value: value})
+}
+
+func (l *bibtexFieldList) addNames(name string, values []string) {
+	var names []string
+
+	for _, value := range values {
+		if formatted := bibtexName(l.cleanString(value)); formatted != "" {
+			names = append(names, formatted)
+		}
+	}
+
+	if len(names) == 0 {
+		return
+	}
+
+	l.addRaw(name, "{"+strings.Join(names, " and ")+"}")
+}
+
+func (l *bibtexFieldList) entry(entryType, key string) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "@%s{%s,%s", entryType, key, bibtexLineEnding)
+
+	for i, field := range l.fields {
+		fmt.Fprintf(&b, bibtexFieldFormat, field.name, field.value)
+
+		if i < len(l.fields)-1 {
+			b.WriteString(",")
+		}
+
+		b.WriteString(bibtexLineEnding)
+	}
+
+	b.WriteString("}" + bibtexLineEnding)
+
+	return b.String()
+}
+
+func bibtexEntryType(format string, parts citationParts) string {
+	entryType := bibtexTypesMap[format]
+
+	if entryType == "" {
+		metrics.fallbackFormat("bibtex")
+		return bibtexTypeMisc
+	}
+
+	if entryType == bibtexTypePhdThesis && isMastersThesis(parts) == true {
+		return bibtexTypeMastersThesis
+	}
+
+	return entryType
+}
+
+func isMastersThesis(parts citationParts) bool {
+	// best guess at the degree, from whatever descriptive info we have
+	var hints []string
+	hints = append(hints, parts["genre"]...)
+	hints = append(hints, parts["description"]...)
+
+	return strings.Contains(strings.ToLower(strings.Join(hints, " ")), "master")
+}
+
+func bibtexCitationKey(data *genericCitation, url string) string {
+	// key is of the form: first author surname + year + first significant title word,
+	// e.g. "smith2020history", falling back to the item id if nothing is available
+
+	var creators []string
+	creators = append(creators, data.authors...)
+	creators = append(creators, data.editors...)
+
+	key := ""
+
+	if len(creators) > 0 {
+		key += bibtexKeyPart(splitName(creators[0]).family)
+	}
+
+	if data.year != 0 {
+		key += fmt.Sprintf("%d", data.year)
+	}
+
+	for _, word := range wordsBySeparator(data.title, " ") {
+		if lowerCaseWordMap[strings.ToLower(word)] == true {
+			continue
+		}
+
+		if part := bibtexKeyPart(word); part != "" {
+			key += part
+			break
+		}
+	}
+
+	if key == "" {
+		key = bibtexKeyPart(path.Base(url))
+	}
+
+	if key == "" {
+		key = "item"
+	}
+
+	return key
+}
+
+// entries that have citation keys, which must be unique within a combined file
+type bibtexKeyedEntry interface {
+	citationKey() string
+	setCitationKey(key string)
+}
+
+func (e *bibtexEncoder) citationKey() string {
+	return e.key
+}
+
+func (e *bibtexEncoder) setCitationKey(key string) {
+	e.key = key
+}
+
+func (e *biblatexEncoder) citationKey() string {
+	return e.key
+}
+
+func (e *biblatexEncoder) setCitationKey(key string) {
+	e.key = key
+}
+
+func uniqueBibtexKeys(entries []bibtexKeyedEntry) []int {
+	// entries sharing a key get the conventional suffixes, in order: "smith2020historya",
+	// "smith2020historyb", ... skipping any suffixed keys that other entries already use.
+	// returns the indexes of the entries whose keys changed.
+
+	counts := make(map[string]int)
+	used := make(map[string]bool)
+
+	for _, entry := range entries {
+		counts[entry.citationKey()]++
+		used[entry.citationKey()] = true
+	}
+
+	var changed []int
+	next := make(map[string]int)
+
+	for i, entry := range entries {
+		key := entry.citationKey()
+
+		if counts[key] < 2 {
+			continue
+		}
+
+		for {
+			suffixed := key + bibtexKeySuffix(next[key])
+			next[key]++
+
+			if used[suffixed] == false {
+				used[suffixed] = true
+				entry.setCitationKey(suffixed)
+				changed = append(changed, i)
+				break
+			}
+		}
+	}
+
+	return changed
+}
+
+func bibtexKeySuffix(n int) string {
+	// a, b, ..., z, aa, ab, ...
+	suffix := ""
+
+	for n >= 0 {
+		suffix = string(rune('a'+n%26)) + suffix
+		n = n/26 - 1
+	}
+
+	return suffix
+}
+
+func bibtexKeyPart(s string) string {
+	// lowercase ascii letters/digits only; accented letters lose their accents
+	var b strings.Builder
+
+	for _, r := range norm.NFD.String(strings.ToLower(s)) {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			b.WriteRune(r)
+		}
+	}
+
+	return b.String()
+}
+
+func bibtexName(name string) string {
+	n := splitName(name)
+
+	switch {
+	case n.family == "":
+		return ""
+
+	// extra braces prevent bibtex from parsing corporate names as personal ones
+	case n.corporate == true:
+		return "{" + bibtexEscape(n.family) + "}"
+	}
+
+	res := bibtexEscape(n.family)
+
+	if n.suffix != "" {
+		res += ", " + bibtexEscape(n.suffix)
+	}
+
+	if n.given != "" {
+		res += ", " + bibtexEscape(n.given)
+	}
+
+	return res
+}
+
+func bibtexEscape(s string) string {
+	return bibtexEscapes.Replace(s)
+}
+
+func init() {
+	// mapping of citation formats (citation part "format") to BibTeX entry type
+	bibtexTypesMap = make(map[string]string)
+
+	bibtexTypesMap["article"] = bibtexTypeArticle
+	bibtexTypesMap["book"] = bibtexTypeBook
+	bibtexTypesMap["government_document"] = bibtexTypeTechReport
+	bibtexTypesMap["journal"] = bibtexTypeArticle
+	bibtexTypesMap["manuscript"] = bibtexTypeUnpublished
+	bibtexTypesMap["news"] = bibtexTypeArticle
+	bibtexTypesMap["thesis"] = bibtexTypePhdThesis
+
+	bibtexMonths = []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}
+
+	// characters with special meaning to LaTeX
+	bibtexEscapes = strings.NewReplacer(
+		`\`, `\textbackslash{}`,
+		`{`, `\{`,
+		`}`, `\}`,
+		`$`, `\$`,
+		`&`, `\&`,
+		`%`, `\%`,
+		`#`, `\#`,
+		`_`, `\_`,
+		`~`, `\textasciitilde{}`,
+		`^`, `\textasciicircum{}`,
+	)
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// circuit breaker states, as reported by the health check
+const (
+	breakerClosed   = "closed"
+	breakerOpen     = "open"
+	breakerHalfOpen = "half-open"
+)
+
+// per-pool circuit breakers: after a number of consecutive failed requests to a
+// pool, requests to it fail fast until a cooldown period has passed.  then a
+// single trial request is let through, which either closes or reopens the breaker.
+// pools are named by their registry id or allowlist entry (see poolKey), rather than
+// by host, so that item urls cannot create any number of breakers.
+type circuitBreaker struct {
+	mutex     sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	pools     map[string]*circuitBreakerPool
+}
+
+type circuitBreakerPool struct {
+	state    string
+	failures int
+	openedAt time.Time
+	probing  bool // a trial request is in flight while half-open
+}
+
+type circuitBreakerStatus struct {
+	pool     string
+	state    string
+	failures int
+}
+
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	b := circuitBreaker{}
+
+	b.threshold = threshold
+	b.cooldown = cooldown
+	b.pools = make(map[string]*circuitBreakerPool)
+
+	return &b
+}
+
+func (b *circuitBreaker) enabled() bool {
+	return b != nil && b.threshold > 0
+}
+
+func (b *circuitBreaker) pool(name string) *circuitBreakerPool {
+	h, ok := b.pools[name]
+	if ok == false {
+		h = &circuitBreakerPool{state: breakerClosed}
+		b.pools[name] = h
+	}
+
+	return h
+}
+
+func (b *circuitBreaker) allow(name string) bool {
+	if b.enabled() == false {
+		return true
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	h := b.pool(name)
+
+	switch h.state {
+	case breakerOpen:
+		if time.Since(h.openedAt) < b.cooldown {
+			return false
+		}
+
+		h.state = breakerHalfOpen
+		h.probing = true
+
+		return true
+
+	case breakerHalfOpen:
+		// only one trial request at a time
+		if h.probing == true {
+			return false
+		}
+
+		h.probing = true
+
+		return true
+	}
+
+	return true
+}
+
+func (b *circuitBreaker) success(name string) {
+	if b.enabled() == false {
+		return
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	h := b.pool(name)
+
+	h.state = breakerClosed
+	h.failures = 0
+	h.probing = false
+}
+
+// ends a trial request that had no bearing on the pool's health, so that
+// the next request can be the trial instead
+func (b *circuitBreaker) release(name string) {
+	if b.enabled() == false {
+		return
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.pool(name).probing = false
+}
+
+// records a failure, and returns true if this caused the breaker to open
+func (b *circuitBreaker) failure(name string) bool {
+	if b.enabled() == false {
+		return false
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	h := b.pool(name)
+
+	h.failures++
+	h.probing = false
+
+	if h.state == breakerHalfOpen || (h.state == breakerClosed && h.failures >= b.threshold) {
+		h.state = breakerOpen
+		h.openedAt = time.Now()
+		return true
+	}
+
+	return false
+}
+
+func (b *circuitBreaker) status() []circuitBreakerStatus {
+	var statuses []circuitBreakerStatus
+
+	if b.enabled() == false {
+		return statuses
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	for name, h := range b.pools {
+		statuses = append(statuses, circuitBreakerStatus{pool: name, state: h.state, failures: h.failures})
+	}
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].pool < statuses[j].pool
+	})
+
+	return statuses
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCircuitBreakerHalfOpen(t *testing.T) {
+	b := newCircuitBreaker(2, time.Millisecond)
+
+	b.failure("solr")
+	if b.failure("solr") == false {
+		t.Fatal("breaker did not open at its threshold")
+	}
+
+	if b.allow("solr") == true {
+		t.Fatal("open breaker allowed a request during its cooldown")
+	}
+
+	time.Sleep(2 * time.Millisecond)
+
+	// a single trial request while half-open
+	if b.allow("solr") == false {
+		t.Fatal("half-open breaker did not allow a trial request")
+	}
+
+	if b.allow("solr") == true {
+		t.Fatal("half-open breaker allowed a second trial request")
+	}
+
+	// a trial that says nothing about the pool lets the next request be the trial
+	b.release("solr")
+
+	if b.allow("solr") == false {
+		t.Fatal("released breaker did not allow another trial request")
+	}
+
+	b.success("solr")
+
+	if status := b.status(); len(status) != 1 || status[0].pool != "solr" || status[0].state != breakerClosed {
+		t.Errorf("status = %+v, want solr closed", status)
+	}
+
+	// other pools are unaffected
+	if b.allow("eds") == false {
+		t.Error("breaker for one pool affected another")
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"container/list"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/uvalib/virgo4-api/v4api"
+)
+
+// bounded, time-limited LRU cache of pool records, keyed by item url and caller claims
+type recordCache struct {
+	mutex   sync.Mutex
+	size    int
+	ttl     time.Duration
+	entries map[string]*list.Element
+	order   *list.List // front is most recently used
+}
+
+type recordCacheEntry struct {
+	key     string
+	rec     *v4api.Record
+	expires time.Time
+}
+
+func newRecordCache(size int, ttl time.Duration) *recordCache {
+	c := recordCache{}
+
+	c.size = size
+	c.ttl = ttl
+	c.entries = make(map[string]*list.Element)
+	c.order = list.New()
+
+	return &c
+}
+
+func (c *recordCache) enabled() bool {
+	return c != nil && c.size > 0 && c.ttl > 0
+}
+
+func (c *recordCache) get(key string) (*v4api.Record, bool) {
+	if c.enabled() == false {
+		return nil, false
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	elem, ok := c.entries[key]
+	if ok == false {
+		return nil, false
+	}
+
+	entry := elem.Value.(*recordCacheEntry)
+
+	if time.Now().After(entry.expires) {
+		c.remove(elem)
+		return nil, false
+	}
+
+	c.order.MoveToFront(elem)
+
+	return entry.rec, true
+}
+
+func (c *recordCache) set(key string, rec *v4api.Record) {
+	if c.enabled() == false {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	expires := time.Now().Add(c.ttl)
+
+	if elem, ok := c.entries[key]; ok == true {
+		entry := elem.Value.(*recordCacheEntry)
+		entry.rec = rec
+		entry.expires = expires
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&recordCacheEntry{key: key, rec: rec, expires: expires})
+
+	for c.order.Len() > c.size {
+		c.remove(c.order.Back())
+	}
+}
+
+func (c *recordCache) remove(elem *list.Element) {
+	entry := elem.Value.(*recordCacheEntry)
+
+	delete(c.entries, entry.key)
+	c.order.Remove(elem)
+}
+
+func (s *citationsContext) getPoolRecord() (*v4api.Record, serviceResponse) {
+	cache := s.svc.cache.records
+	key := s.poolRecordKey()
+
+	if cache.enabled() == true {
+		if s.client.opts.nocache == true {
+			s.log("[CACHE] bypassed for %s", s.url)
+			metrics.cacheLookup("bypass")
+		} else if rec, ok := cache.get(key); ok == true {
+			s.log("[CACHE] hit for %s", s.url)
+			metrics.cacheLookup("hit")
+			return rec, serviceResponse{status: http.StatusOK}
+		} else {
+			s.log("[CACHE] miss for %s", s.url)
+			metrics.cacheLookup("miss")
+		}
+	}
+
+	rec, resp := s.sharedPoolRecord()
+
+	if resp.err == nil {
+		cache.set(key, rec)
+	}
+
+	return rec, resp
+}
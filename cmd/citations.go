@@ -1,8 +1,14 @@
 package main
 
 import (
+	"context"
 	"net/http"
 	"path"
+	"time"
+
+	"github.com/uvalib/virgo4-api/v4api"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type citationType interface {
@@ -21,40 +27,55 @@ type citationsContext struct {
 	client      *clientContext
 	url         string
 	v4url       string
+	pool        *poolRegistryEntry
+	ctx         context.Context // trace context for spans
+	poolLatency time.Duration   // of the most recent pool request, for logging
 	parts       citationParts
 	initialized bool
 }
 
 type serviceResponse struct {
-	status int   // http status code
-	err    error // error, if any
+	status int    // http status code
+	code   string // kind of error, if not implied by the status (see errorCode)
+	err    error  // error, if any
 }
 
 func (s *citationsContext) init(p *serviceContext, c *clientContext) {
-	s.svc = p
-	s.client = c
-
 	// v4 uses "item", but unAPI uses "id".  these are equivalent identifiers
-	s.url = c.ginCtx.Query("item")
-	if s.url == "" {
-		s.url = c.ginCtx.Query("id")
+	url := c.ginCtx.Query("item")
+	if url == "" {
+		url = c.ginCtx.Query("id")
 	}
 
-	if id := path.Base(s.url); id != "" && s.svc.config.URLPrefix != "" {
-		s.v4url = s.svc.config.URLPrefix + id
+	s.initWithURL(p, c, url)
+}
+
+func (s *citationsContext) initWithURL(p *serviceContext, c *clientContext, url string) {
+	s.svc = p
+	s.client = c
+	s.url = url
+	s.pool = s.svc.registry.lookup(s.url)
+	s.ctx = c.ctx
+
+	if s.url != "" {
+		s.v4url = s.svc.itemURL(s.pool, path.Base(s.url))
 	}
 }
 
 func (s *citationsContext) log(format string, args ...interface{}) {
-	s.client.log(format, args...)
+	if s.client.nolog == true {
+		return
+	}
+
+	s.client.output("", s.logAttrs(), format, args...)
 }
 
 func (s *citationsContext) warn(format string, args ...interface{}) {
-	s.client.warn(format, args...)
+	s.client.output("WARNING:", s.logAttrs(), format, args...)
 }
 
 func (s *citationsContext) err(format string, args ...interface{}) {
-	s.client.err(format, args...)
+	s.client.output("ERROR:", s.logAttrs(), format, args...)
 }
 
 func (s *citationsContext) collectCitationParts() serviceResponse {
@@ -62,23 +83,37 @@ func (s *citationsContext) collectCitationParts() serviceResponse {
 		return serviceResponse{status: http.StatusOK}
 	}
 
-	rec, resp := s.queryPoolRecord()
+	rec, resp := s.getPoolRecord()
 
 	if resp.err != nil {
 		return resp
 	}
 
-	s.parts = make(citationParts)
+	s.parts = citationPartsFromRecord(rec)
+	s.initialized = true
+
+	return serviceResponse{status: http.StatusOK}
+}
+
+// names an item (e.g. for file names and ids) after its url, if it has one
+func itemName(url string) string {
+	if url == "" {
+		return "citation"
+	}
+
+	return path.Base(url)
+}
+
+func citationPartsFromRecord(rec *v4api.Record) citationParts {
+	parts := make(citationParts)
 
 	for _, field := range rec.Fields {
 		if field.CitationPart != "" && field.Value != "" {
-			s.parts[field.CitationPart] = append(s.parts[field.CitationPart], field.Value)
+			parts[field.CitationPart] = append(parts[field.CitationPart], field.Value)
 		}
 	}
 
-	s.initialized = true
-
-	return serviceResponse{status: http.StatusOK}
+	return parts
 }
 
 func (s *citationsContext) handleCitationRequest(fmts []citationType) serviceResponse {
@@ -91,7 +126,11 @@ func (s *citationsContext) handleCitationRequest(fmts []citationType) serviceRes
 	for _, fmt := range fmts {
 		fmt.Init(s.client, s.v4url)
 
-		if err := fmt.Populate(s.parts); err != nil {
+		_, span := s.startSpan("Populate", trace.WithAttributes(attribute.String("citation.style", fmt.Label())))
+		err := fmt.Populate(s.parts)
+		endSpan(span, 0, err)
+
+		if err != nil {
 			return serviceResponse{status: http.StatusInternalServerError, err: err}
 		}
 	}
@@ -1,7 +1,6 @@
 package main
 
 import (
-	"errors"
 	"strings"
 )
 
@@ -53,5 +52,7 @@ func (e *citeAsEncoder) Contents() (string, error) {
 		return strings.Join(e.data.citeAs, "\n"), nil
 	}
 
-	return "", errors.New("no explicit citation for this item")
+	metrics.noExplicitCitation()
+
+	return "", errNoExplicitCitation
 }
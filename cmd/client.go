@@ -1,10 +1,10 @@
 package main
 
 import (
+	"context"
 	"fmt"
-	"log"
+	"log/slog"
 	"strconv"
-	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -16,15 +16,20 @@ type clientOpts struct {
 	verbose bool // controls whether verbose requests/responses are logged
 	inline  bool // controls whether citations are provided as downloads or inline
 	nohtml  bool // controls whether citations contain html elements
+	nocache bool // controls whether cached pool records may be used
 }
 
 type clientContext struct {
-	reqID  string          // internally generated
-	start  time.Time       // internally set
-	opts   clientOpts      // options set by client
-	claims *v4jwt.V4Claims // information about this user
-	nolog  bool            // internally set
-	ginCtx *gin.Context    // gin context
+	reqID      string          // internally generated
+	start      time.Time       // internally set
+	opts       clientOpts      // options set by client
+	claims     *v4jwt.V4Claims // information about this user
+	nolog      bool            // internally set
+	jsonErrors bool            // internally set; whether errors are reported as json, or as plain text
+	styles     []string        // internally set; the citation styles requested, for logging
+	logger     *slog.Logger    // structured logger, if any
+	ctx        context.Context // trace context of the request
+	ginCtx     *gin.Context    // gin context
 }
 
 func boolOptionWithFallback(opt string, fallback bool) bool {
@@ -42,17 +47,23 @@ func (c *clientContext) init(p *serviceContext, ctx *gin.Context) {
 	c.ginCtx = ctx
 
 	c.start = time.Now()
-	c.reqID = fmt.Sprintf("%08x", p.randomSource.Uint32())
+	c.logger = p.logger
+
+	c.initRequestID(p)
+	c.initTrace()
 
 	// get claims, if any
 	if val, ok := ctx.Get("claims"); ok == true {
 		c.claims = val.(*v4jwt.V4Claims)
 	}
 
+	c.jsonErrors = jsonErrorsForRoute(ctx)
+
 	c.opts.debug = boolOptionWithFallback(ctx.Query("debug"), false)
 	c.opts.verbose = boolOptionWithFallback(ctx.Query("verbose"), false)
 	c.opts.inline = boolOptionWithFallback(ctx.Query("inline"), false)
 	c.opts.nohtml = boolOptionWithFallback(ctx.Query("nohtml"), false)
+	c.opts.nocache = boolOptionWithFallback(ctx.Query("nocache"), false)
 }
 
 func (c *clientContext) logRequest() {
@@ -69,24 +80,20 @@ func (c *clientContext) logRequest() {
 	c.log("[REQUEST] %s %s%s  %s", c.ginCtx.Request.Method, c.ginCtx.Request.URL.Path, query, claimsStr)
 }
 
-func (c *clientContext) logResponse(resp serviceResponse) {
+func (c *clientContext) logResponse(resp serviceResponse, extra ...slog.Attr) {
+	if c.nolog == true {
+		return
+	}
+
 	msg := fmt.Sprintf("[RESPONSE] status: %d", resp.status)
+	attrs := append(extra, slog.Int("status", resp.status))
 
 	if resp.err != nil {
 		msg = msg + fmt.Sprintf(", error: %s", resp.err.Error())
+		attrs = append(attrs, slog.String("error_class", resp.errorCode()))
 	}
 
-	c.log(msg)
-}
-
-func (c *clientContext) printf(prefix, format string, args ...interface{}) {
-	str := fmt.Sprintf(format, args...)
-
-	if prefix != "" {
-		str = strings.Join([]string{prefix, str}, " ")
-	}
-
-	log.Printf("[%s] %s", c.reqID, str)
+	c.output("", attrs, "%s", msg)
 }
 
 func (c *clientContext) log(format string, args ...interface{}) {
@@ -94,15 +101,15 @@ func (c *clientContext) log(format string, args ...interface{}) {
 		return
 	}
 
-	c.printf("", format, args...)
+	c.output("", nil, format, args...)
 }
 
 func (c *clientContext) warn(format string, args ...interface{}) {
-	c.printf("WARNING:", format, args...)
+	c.output("WARNING:", nil, format, args...)
 }
 
 func (c *clientContext) err(format string, args ...interface{}) {
-	c.printf("ERROR:", format, args...)
+	c.output("ERROR:", nil, format, args...)
 }
 
 func (c *clientContext) italics(s string) string {
@@ -12,13 +12,61 @@ import (
 const envPrefix = "VIRGO4_CITATIONS_WS"
 
 type serviceConfigPools struct {
-	ConnTimeout string `json:"conn_timeout,omitempty"`
-	ReadTimeout string `json:"read_timeout,omitempty"`
+	ConnTimeout      string   `json:"conn_timeout,omitempty"`
+	ReadTimeout      string   `json:"read_timeout,omitempty"`
+	Retries          string   `json:"retries,omitempty"`
+	RetryBackoff     string   `json:"retry_backoff,omitempty"`
+	RetryMaxBackoff  string   `json:"retry_max_backoff,omitempty"`
+	BreakerThreshold string   `json:"breaker_threshold,omitempty"`
+	BreakerCooldown  string   `json:"breaker_cooldown,omitempty"`
+	Allowed          []string `json:"allowed,omitempty"`
+	AllowPrivate     bool     `json:"allow_private,omitempty"`
+}
+
+type serviceConfigRegistry struct {
+	URL     string `json:"url,omitempty"`
+	File    string `json:"file,omitempty"`
+	Refresh string `json:"refresh,omitempty"`
+	ItemURL string `json:"item_url,omitempty"`
+}
+
+type serviceConfigLogging struct {
+	Format string `json:"format,omitempty"`
+}
+
+type serviceConfigTracing struct {
+	Exporter string `json:"exporter,omitempty"`
+	Endpoint string `json:"endpoint,omitempty"`
+}
+
+type serviceConfigHealth struct {
+	Interval string   `json:"interval,omitempty"`
+	Canaries []string `json:"canaries,omitempty"`
+}
+
+type serviceConfigBatch struct {
+	MaxItems string `json:"max_items,omitempty"`
+	Workers  string `json:"workers,omitempty"`
+}
+
+type serviceConfigCache struct {
+	Size string `json:"size,omitempty"`
+	TTL  string `json:"ttl,omitempty"`
 }
 
 type serviceConfigJWT struct {
 	Key        string `json:"key,omitempty"`
 	Expiration int    `json:"expiration,omitempty"`
+	Anonymous  string `json:"anonymous,omitempty"`
+}
+
+type serviceConfigCSL struct {
+	StyleDir string `json:"style_dir,omitempty"`
+}
+
+type serviceConfigOpenURL struct {
+	ResolverURL string `json:"resolver_url,omitempty"`
+	ReferrerID  string `json:"referrer_id,omitempty"`
 }
 
 type serviceConfigFormat struct {
@@ -28,20 +76,41 @@ type serviceConfigFormat struct {
 }
 
 type serviceConfigFormats struct {
-	APA    serviceConfigFormat `json:"apa,omitempty"`
-	CiteAs serviceConfigFormat `json:"cite_as,omitempty"`
-	CMS    serviceConfigFormat `json:"cms,omitempty"`
-	LBB    serviceConfigFormat `json:"lbb,omitempty"`
-	MLA    serviceConfigFormat `json:"mla,omitempty"`
-	RIS    serviceConfigFormat `json:"ris,omitempty"`
+	APA      serviceConfigFormat `json:"apa,omitempty"`
+	BibLaTeX serviceConfigFormat `json:"biblatex,omitempty"`
+	BibTeX   serviceConfigFormat `json:"bibtex,omitempty"`
+	CiteAs   serviceConfigFormat `json:"cite_as,omitempty"`
+	CMS      serviceConfigFormat `json:"cms,omitempty"`
+	COinS    serviceConfigFormat `json:"coins,omitempty"`
+	CSL      serviceConfigFormat `json:"csl,omitempty"`
+	CSLJSON  serviceConfigFormat `json:"csl_json,omitempty"`
+	DC       serviceConfigFormat `json:"dc,omitempty"`
+	DCJSON   serviceConfigFormat `json:"dc_json,omitempty"`
+	EndNote  serviceConfigFormat `json:"endnote,omitempty"`
+	Enw      serviceConfigFormat `json:"enw,omitempty"`
+	JSONLD   serviceConfigFormat `json:"jsonld,omitempty"`
+	LBB      serviceConfigFormat `json:"lbb,omitempty"`
+	MLA      serviceConfigFormat `json:"mla,omitempty"`
+	MODS     serviceConfigFormat `json:"mods,omitempty"`
+	OpenURL  serviceConfigFormat `json:"openurl,omitempty"`
+	Resolver serviceConfigFormat `json:"openurl_resolver,omitempty"`
+	RIS      serviceConfigFormat `json:"ris,omitempty"`
 }
 
 type serviceConfig struct {
-	Port      string               `json:"port,omitempty"`
-	URLPrefix string               `json:"url_prefix,omitempty"`
-	JWT       serviceConfigJWT     `json:"jwt,omitempty"`
-	Pools     serviceConfigPools   `json:"pools,omitempty"`
-	Formats   serviceConfigFormats `json:"formats,omitempty"`
+	Port      string                `json:"port,omitempty"`
+	URLPrefix string                `json:"url_prefix,omitempty"`
+	JWT       serviceConfigJWT      `json:"jwt,omitempty"`
+	Logging   serviceConfigLogging  `json:"logging,omitempty"`
+	Tracing   serviceConfigTracing  `json:"tracing,omitempty"`
+	Pools     serviceConfigPools    `json:"pools,omitempty"`
+	Registry  serviceConfigRegistry `json:"registry,omitempty"`
+	Health    serviceConfigHealth   `json:"health,omitempty"`
+	Batch     serviceConfigBatch    `json:"batch,omitempty"`
+	Cache     serviceConfigCache    `json:"cache,omitempty"`
+	Formats   serviceConfigFormats  `json:"formats,omitempty"`
+	CSL       serviceConfigCSL      `json:"csl,omitempty"`
+	OpenURL   serviceConfigOpenURL  `json:"openurl,omitempty"`
 }
 
 func getSortedJSONEnvVars() []string {
@@ -0,0 +1,375 @@
+package main
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// generic CSL XML element; styles are interpreted directly from this tree
+type cslNode struct {
+	XMLName xml.Name
+	Attrs   []xml.Attr `xml:",any,attr"`
+	Nodes   []*cslNode `xml:",any"`
+	Text    string     `xml:",chardata"`
+}
+
+type cslStyle struct {
+	id                 string
+	title              string
+	parentID           string
+	root               *cslNode
+	macros             map[string]*cslNode
+	citation           *cslNode
+	bibliography       *cslNode
+	locale             *cslNode
+	terms              cslTerms
+	dates              map[string]*cslNode
+	punctuationInQuote bool
+}
+
+type cslEncoder struct {
+	cfg          serviceConfigFormat
+	url          string
+	preferCiteAs bool
+	style        *cslStyle
+	item         *cslItem
+	citeAs       []string
+	ctx          *clientContext
+}
+
+func (n *cslNode) attr(name string) string {
+	for _, a := range n.Attrs {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+
+	return ""
+}
+
+func (n *cslNode) hasAttr(name string) bool {
+	for _, a := range n.Attrs {
+		if a.Name.Local == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (n *cslNode) name() string {
+	return n.XMLName.Local
+}
+
+func (n *cslNode) child(name string) *cslNode {
+	for _, node := range n.Nodes {
+		if node.name() == name {
+			return node
+		}
+	}
+
+	return nil
+}
+
+func (n *cslNode) children(name string) []*cslNode {
+	var nodes []*cslNode
+
+	for _, node := range n.Nodes {
+		if node.name() == name {
+			nodes = append(nodes, node)
+		}
+	}
+
+	return nodes
+}
+
+func parseCSLStyle(data []byte) (*cslStyle, error) {
+	var root cslNode
+
+	if err := xml.Unmarshal(data, &root); err != nil {
+		return nil, err
+	}
+
+	if root.name() != "style" {
+		return nil, fmt.Errorf("unexpected root element: [%s]", root.name())
+	}
+
+	s := cslStyle{root: &root}
+
+	if info := root.child("info"); info != nil {
+		if id := info.child("id"); id != nil {
+			s.id = strings.TrimSpace(id.Text)
+		}
+
+		if title := info.child("title"); title != nil {
+			s.title = strings.TrimSpace(title.Text)
+		}
+
+		for _, link := range info.children("link") {
+			if link.attr("rel") == "independent-parent" {
+				s.parentID = link.attr("href")
+			}
+		}
+	}
+
+	s.macros = make(map[string]*cslNode)
+	for _, macro := range root.children("macro") {
+		s.macros[macro.attr("name")] = macro
+	}
+
+	// macros are expanded recursively when rendering, so they must not refer to themselves
+	if err := s.checkMacroCycles(); err != nil {
+		return nil, err
+	}
+
+	s.citation = root.child("citation")
+	s.bibliography = root.child("bibliography")
+	s.locale = root.child("locale")
+
+	if s.parentID == "" && s.citation == nil && s.bibliography == nil {
+		return nil, errors.New("style has no citation or bibliography")
+	}
+
+	s.setupLocale()
+
+	return &s, nil
+}
+
+func (s *cslStyle) checkMacroCycles() error {
+	// macros still being visited (on the current path), or fully visited
+	const (
+		visiting = 1
+		visited  = 2
+	)
+
+	state := make(map[string]int)
+
+	var visit func(name string) error
+	var walk func(n *cslNode) error
+
+	walk = func(n *cslNode) error {
+		if n.hasAttr("macro") == true {
+			if err := visit(n.attr("macro")); err != nil {
+				return err
+			}
+		}
+
+		for _, child := range n.Nodes {
+			if err := walk(child); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	visit = func(name string) error {
+		switch state[name] {
+		case visiting:
+			return fmt.Errorf("macro [%s] refers to itself", name)
+		case visited:
+			return nil
+		}
+
+		macro := s.macros[name]
+		if macro == nil {
+			return nil
+		}
+
+		state[name] = visiting
+
+		for _, child := range macro.Nodes {
+			if err := walk(child); err != nil {
+				return err
+			}
+		}
+
+		state[name] = visited
+
+		return nil
+	}
+
+	for name := range s.macros {
+		if err := visit(name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *cslStyle) setupLocale() {
+	s.terms = cslDefaultTerms.merge(s.locale)
+
+	s.dates = make(map[string]*cslNode)
+	for form, date := range cslDefaultDates {
+		s.dates[form] = date
+	}
+
+	s.punctuationInQuote = true
+
+	if s.locale == nil {
+		return
+	}
+
+	for _, date := range s.locale.children("date") {
+		s.dates[date.attr("form")] = date
+	}
+
+	if opts := s.locale.child("style-options"); opts != nil && opts.hasAttr("punctuation-in-quote") == true {
+		s.punctuationInQuote = opts.attr("punctuation-in-quote") == "true"
+	}
+}
+
+func (s *cslStyle) inherit(parent *cslStyle) *cslStyle {
+	// dependent styles only supply metadata (and possibly a locale) for their parent
+	d := *parent
+
+	d.id = s.id
+	d.title = s.title
+	d.parentID = ""
+
+	if s.locale != nil {
+		d.locale = s.locale
+		d.setupLocale()
+	}
+
+	return &d
+}
+
+func loadCSLStyles(dir string) map[string]*cslStyle {
+	// styles are keyed by file name (minus extension), e.g. "ieee" for ieee.csl
+	styles := make(map[string]*cslStyle)
+
+	if dir == "" {
+		return styles
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.csl"))
+	if err != nil {
+		log.Printf("[CSL] error listing styles in %s: %s", dir, err.Error())
+		return styles
+	}
+
+	dependents := make(map[string]*cslStyle)
+
+	for _, file := range files {
+		key := strings.TrimSuffix(filepath.Base(file), ".csl")
+
+		data, readErr := os.ReadFile(file)
+		if readErr != nil {
+			log.Printf("[CSL] WARNING: skipping %s: %s", file, readErr.Error())
+			continue
+		}
+
+		style, parseErr := parseCSLStyle(data)
+		if parseErr != nil {
+			log.Printf("[CSL] WARNING: skipping %s: %s", file, parseErr.Error())
+			continue
+		}
+
+		if style.parentID != "" {
+			dependents[key] = style
+			continue
+		}
+
+		styles[key] = style
+	}
+
+	// resolve dependent styles against their parents, which must also be present
+	for key, style := range dependents {
+		parent := styles[path.Base(style.parentID)]
+
+		if parent == nil {
+			log.Printf("[CSL] WARNING: skipping %s: parent style %s not found", key, style.parentID)
+			continue
+		}
+
+		styles[key] = style.inherit(parent)
+	}
+
+	var keys []string
+	for key := range styles {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	log.Printf("[CSL] loaded %d style(s) from %s: %s", len(keys), dir, strings.Join(keys, ", "))
+
+	return styles
+}
+
+func newCSLEncoder(cfg serviceConfigFormat, style *cslStyle, preferCiteAs bool) *cslEncoder {
+	e := cslEncoder{}
+
+	e.cfg = cfg
+	e.style = style
+	e.preferCiteAs = preferCiteAs
+
+	return &e
+}
+
+func (e *cslEncoder) Init(c *clientContext, url string) {
+	e.url = url
+	e.ctx = c
+}
+
+func (e *cslEncoder) Populate(parts citationParts) error {
+	var err error
+
+	if e.item, err = newCSLItem(e.url, parts, "csl"); err != nil {
+		return err
+	}
+
+	e.citeAs = parts["explicit"]
+
+	return nil
+}
+
+func (e *cslEncoder) Label() string {
+	if e.style.title != "" {
+		return e.style.title
+	}
+
+	return e.cfg.Label
+}
+
+func (e *cslEncoder) ContentType() string {
+	return e.cfg.ContentType
+}
+
+func (e *cslEncoder) FileName() string {
+	return ""
+}
+
+func (e *cslEncoder) Contents() (string, error) {
+	if e.preferCiteAs == true && len(e.citeAs) > 0 {
+		return strings.Join(e.citeAs, "\n"), nil
+	}
+
+	// prefer the bibliographic form of the style, if it has one
+	layout := e.style.bibliography
+	if layout == nil {
+		layout = e.style.citation
+	}
+
+	html := e.ctx == nil || e.ctx.opts.nohtml == false
+
+	r := newCSLRenderer(e.style, layout, e.item, html)
+
+	res := r.render()
+
+	if res == "" {
+		return "", errors.New("style produced an empty citation for this item")
+	}
+
+	return res, nil
+}
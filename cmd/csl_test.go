@@ -0,0 +1,179 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// a small author-date style, loosely modelled on APA
+const testAPAStyle = `<?xml version="1.0" encoding="utf-8"?>
+<style xmlns="http://purl.org/net/xbiblio/csl" class="in-text" version="1.0">
+  <info><title>Test APA</title><id>http://example.org/styles/test-apa</id></info>
+  <macro name="author">
+    <names variable="author">
+      <name and="symbol" delimiter=", " initialize-with=". " name-as-sort-order="all"/>
+      <substitute><names variable="editor"/><text macro="title"/></substitute>
+    </names>
+  </macro>
+  <macro name="title"><text variable="title" font-style="italic"/></macro>
+  <macro name="issued">
+    <choose>
+      <if variable="issued"><date variable="issued"><date-part name="year"/></date></if>
+      <else><text term="no date" form="short"/></else>
+    </choose>
+  </macro>
+  <citation><layout prefix="(" suffix=")"><text macro="author"/></layout></citation>
+  <bibliography>
+    <layout suffix=".">
+      <text macro="author" suffix=" "/>
+      <text macro="issued" prefix="(" suffix="). "/>
+      <choose>
+        <if type="article-journal">
+          <text variable="title"/>
+          <group prefix=". " delimiter=", ">
+            <text variable="container-title" font-style="italic"/>
+            <text variable="volume"/>
+            <text variable="page"/>
+          </group>
+        </if>
+        <else>
+          <text macro="title"/>
+          <text variable="publisher" prefix=". "/>
+        </else>
+      </choose>
+    </layout>
+  </bibliography>
+</style>`
+
+// a dependent style, which only supplies metadata for its parent
+const testDependentStyle = `<?xml version="1.0" encoding="utf-8"?>
+<style xmlns="http://purl.org/net/xbiblio/csl" version="1.0">
+  <info><title>Test Department</title><id>http://example.org/styles/test-dept</id>
+  <link href="http://example.org/styles/test-apa" rel="independent-parent"/></info>
+</style>`
+
+const testCyclicStyle = `<?xml version="1.0" encoding="utf-8"?>
+<style xmlns="http://purl.org/net/xbiblio/csl" version="1.0">
+  <info><title>Test Cyclic</title><id>http://example.org/styles/test-cyclic</id></info>
+  <macro name="a"><text macro="b"/></macro>
+  <macro name="b"><group><text macro="a"/></group></macro>
+  <bibliography><layout><text macro="a"/></layout></bibliography>
+</style>`
+
+func loadTestCSLStyles(t *testing.T, files map[string]string) map[string]*cslStyle {
+	dir := t.TempDir()
+
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name+".csl"), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return loadCSLStyles(dir)
+}
+
+func TestCSLRender(t *testing.T) {
+	styles := loadTestCSLStyles(t, map[string]string{
+		"test-apa":  testAPAStyle,
+		"test-dept": testDependentStyle,
+	})
+
+	article := citationParts{
+		"format":         {"article"},
+		"author":         {"Smith, John", "Doe, Jane"},
+		"title":          {"A study of things"},
+		"journal":        {"Journal of Things"},
+		"volume":         {"12"},
+		"pages":          {"100-120"},
+		"published_date": {"2020"},
+	}
+
+	book := citationParts{
+		"format":    {"book"},
+		"author":    {"Jones, Bob"},
+		"title":     {"Stuff"},
+		"publisher": {"Oxford UP"},
+	}
+
+	edited := citationParts{
+		"format":         {"book"},
+		"editor":         {"Roe, Richard"},
+		"title":          {"Collected stuff"},
+		"published_date": {"1999"},
+	}
+
+	tests := []struct {
+		style  string
+		parts  citationParts
+		nohtml bool
+		want   string
+	}{
+		{"test-apa", article, true, "Smith, J. & Doe, J. (2020). A study of things. Journal of Things, 12, 100–120."},
+		{"test-apa", article, false, "Smith, J. &amp; Doe, J. (2020). A study of things. <em>Journal of Things</em>, 12, 100–120."},
+		{"test-apa", book, true, "Jones, B. (n.d.). Stuff. Oxford UP."},
+		{"test-apa", edited, true, "Roe, R. (1999). Collected stuff."},
+		{"test-dept", book, true, "Jones, B. (n.d.). Stuff. Oxford UP."},
+	}
+
+	for _, test := range tests {
+		style := styles[test.style]
+		if style == nil {
+			t.Fatalf("style %s was not loaded", test.style)
+		}
+
+		cl := clientContext{}
+		cl.opts.nohtml = test.nohtml
+
+		e := newCSLEncoder(serviceConfigFormat{Label: "CSL"}, style, false)
+		e.Init(&cl, "https://search.lib.virginia.edu/items/u1")
+
+		if err := e.Populate(test.parts); err != nil {
+			t.Fatalf("%s: Populate() failed: %s", test.style, err.Error())
+		}
+
+		got, err := e.Contents()
+		if err != nil {
+			t.Fatalf("%s: Contents() failed: %s", test.style, err.Error())
+		}
+
+		if got != test.want {
+			t.Errorf("%s (nohtml=%v):\n got: %s\nwant: %s", test.style, test.nohtml, got, test.want)
+		}
+	}
+}
+
+func TestCSLDependentStyle(t *testing.T) {
+	styles := loadTestCSLStyles(t, map[string]string{
+		"test-apa":  testAPAStyle,
+		"test-dept": testDependentStyle,
+	})
+
+	dept := styles["test-dept"]
+	if dept == nil {
+		t.Fatal("dependent style was not loaded")
+	}
+
+	if dept.title != "Test Department" || dept.bibliography == nil {
+		t.Errorf("dependent style did not inherit from its parent: title = %q", dept.title)
+	}
+
+	// dependent styles without their parent are skipped
+	styles = loadTestCSLStyles(t, map[string]string{"test-dept": testDependentStyle})
+
+	if _, ok := styles["test-dept"]; ok == true {
+		t.Error("dependent style without a parent was loaded")
+	}
+}
+
+func TestCSLMacroCycles(t *testing.T) {
+	_, err := parseCSLStyle([]byte(testCyclicStyle))
+	if err == nil || strings.Contains(err.Error(), "refers to itself") == false {
+		t.Errorf("expected a macro cycle error, got: %v", err)
+	}
+
+	if _, err := parseCSLStyle([]byte(testAPAStyle)); err != nil {
+		t.Errorf("unexpected error for a style with nested macros: %s", err.Error())
+	}
+}
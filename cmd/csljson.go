@@ -0,0 +1,268 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+
+	"github.com/microcosm-cc/bluemonday"
+)
+
+// CSL item types
+const cslTypeArticleJournal = "article-journal"
+const cslTypeArticleNewspaper = "article-newspaper"
+const cslTypeBook = "book"
+const cslTypeDocument = "document"
+const cslTypeGraphic = "graphic"
+const cslTypeManuscript = "manuscript"
+const cslTypeMap = "map"
+const cslTypeMotionPicture = "motion_picture"
+const cslTypeReport = "report"
+const cslTypeSong = "song"
+const cslTypeThesis = "thesis"
+const cslTypeWebpage = "webpage"
+
+type cslName struct {
+	Family  string `json:"family,omitempty"`
+	Given   string `json:"given,omitempty"`
+	Suffix  string `json:"suffix,omitempty"`
+	Literal string `json:"literal,omitempty"`
+}
+
+type cslDate struct {
+	DateParts [][]int `json:"date-parts,omitempty"`
+	Literal   string  `json:"literal,omitempty"`
+}
+
+// a CSL-JSON item; see https://citeproc-js.readthedocs.io/en/latest/csl-json/markup.html
+type cslItem struct {
+	ID              string    `json:"id"`
+	Type            string    `json:"type"`
+	Author          []cslName `json:"author,omitempty"`
+	Editor          []cslName `json:"editor,omitempty"`
+	Translator      []cslName `json:"translator,omitempty"`
+	Compiler        []cslName `json:"compiler,omitempty"`
+	Contributor     []cslName `json:"contributor,omitempty"`
+	Title           string    `json:"title,omitempty"`
+	ContainerTitle  string    `json:"container-title,omitempty"`
+	CollectionTitle string    `json:"collection-title,omitempty"`
+	Edition         string    `json:"edition,omitempty"`
+	Volume          string    `json:"volume,omitempty"`
+	Issue           string    `json:"issue,omitempty"`
+	Page            string    `json:"page,omitempty"`
+	Genre           string    `json:"genre,omitempty"`
+	Publisher       string    `json:"publisher,omitempty"`
+	PublisherPlace  string    `json:"publisher-place,omitempty"`
+	Issued          *cslDate  `json:"issued,omitempty"`
+	DOI             string    `json:"DOI,omitempty"`
+	URL             string    `json:"URL,omitempty"`
+	ISBN            string    `json:"ISBN,omitempty"`
+	ISSN            string    `json:"ISSN,omitempty"`
+	Language        string    `json:"language,omitempty"`
+	Keyword         string    `json:"keyword,omitempty"`
+	Abstract        string    `json:"abstract,omitempty"`
+}
+
+type cslJSONEncoder struct {
+	cfg  serviceConfigFormat
+	url  string
+	item *cslItem
+}
+
+var cslTypesMap map[string]string
+
+func newCSLJSONEncoder(cfg serviceConfigFormat) *cslJSONEncoder {
+	e := cslJSONEncoder{}
+
+	e.cfg = cfg
+
+	return &e
+}
+
+func (e *cslJSONEncoder) Init(c *clientContext, url string) {
+	e.url = url
+}
+
+func (e *cslJSONEncoder) Populate(parts citationParts) error {
+	var err error
+
+	if e.item, err = newCSLItem(e.url, parts, "csl-json"); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (e *cslJSONEncoder) Label() string {
+	return e.cfg.Label
+}
+
+func (e *cslJSONEncoder) ContentType() string {
+	return e.cfg.ContentType
+}
+
+func (e *cslJSONEncoder) FileName() string {
+	filename := itemName(e.url)
+
+	if e.cfg.Extension != "" {
+		filename += "." + e.cfg.Extension
+	}
+
+	return filename
+}
+
+func (e *cslJSONEncoder) Contents() (string, error) {
+	var b bytes.Buffer
+
+	// csl-json is conventionally a list of items, even if there is just one
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+
+	if err := enc.Encode([]*cslItem{e.item}); err != nil {
+		return "", err
+	}
+
+	return b.String(), nil
+}
+
+// the style is only used to tell csl and csl-json apart in metrics
+func newCSLItem(url string, parts citationParts, style string) (*cslItem, error) {
+	data, err := newRawCitation(url, parts)
+	if err != nil {
+		return nil, err
+	}
+
+	policy := bluemonday.StrictPolicy()
+
+	clean := func(s string) string {
+		return plainText(policy, s)
+	}
+
+	names := func(values []string) []cslName {
+		var res []cslName
+
+		for _, value := range values {
+			if name := cslNameFrom(clean(value)); name != nil {
+				res = append(res, *name)
+			}
+		}
+
+		return res
+	}
+
+	item := cslItem{}
+
+	item.ID = itemName(url)
+	item.Type = cslItemType(data.format, firstElementOf(parts["is_online_only"]) == "true", style)
+
+	item.Author = names(data.authors)
+	item.Editor = names(data.editors)
+	item.Translator = names(data.translators)
+	item.Compiler = names(data.compilers)
+	item.Contributor = names(data.advisors)
+
+	item.Title = clean(data.title)
+	item.ContainerTitle = clean(data.journal)
+	item.CollectionTitle = clean(firstElementOf(parts["series"]))
+	item.Edition = clean(cleanEndPunctuation(firstElementOf(parts["edition"])))
+	item.Volume = clean(data.volume)
+	item.Issue = clean(data.issue)
+
+	item.Page = data.pageFrom
+	if data.pageTo != "" {
+		item.Page += "-" + data.pageTo
+	}
+
+	if item.Type == cslTypeThesis {
+		if isMastersThesis(parts) == true {
+			item.Genre = "Master's thesis"
+		} else {
+			item.Genre = "Doctoral dissertation"
+		}
+	}
+
+	item.Publisher = clean(data.publisher)
+	item.PublisherPlace = clean(cleanEndPunctuation(firstElementOf(parts["published_location"])))
+
+	if data.year != 0 {
+		dateParts := []int{data.year}
+
+		if data.month != 0 {
+			dateParts = append(dateParts, data.month)
+
+			if data.day != 0 {
+				dateParts = append(dateParts, data.day)
+			}
+		}
+
+		item.Issued = &cslDate{DateParts: [][]int{dateParts}}
+	}
+
+	item.DOI = re.doiPrefix.ReplaceAllString(firstElementOf(parts["doi"]), "")
+
+	item.URL = firstElementOf(parts["url"])
+	if item.URL == "" {
+		item.URL = url
+	}
+
+	serialNumber := strings.Join(parts["serial_number"], ", ")
+	if serialNumberKind(data.format) == serialNumberISSN {
+		item.ISSN = serialNumber
+	} else {
+		item.ISBN = serialNumber
+	}
+
+	item.Language = clean(firstElementOf(parts["language"]))
+	item.Keyword = clean(strings.Join(parts["subject"], ", "))
+	item.Abstract = clean(strings.Join(parts["abstract"], " "))
+
+	return &item, nil
+}
+
+func cslItemType(format string, isOnlineOnly bool, style string) string {
+	if itemType := cslTypesMap[format]; itemType != "" {
+		return itemType
+	}
+
+	// otherwise unclassified items that only exist online
+	if isOnlineOnly == true {
+		return cslTypeWebpage
+	}
+
+	metrics.fallbackFormat(style)
+
+	return cslTypeDocument
+}
+
+func cslNameFrom(name string) *cslName {
+	n := splitName(name)
+
+	switch {
+	case n.family == "":
+		return nil
+
+	case n.corporate == true:
+		return &cslName{Literal: n.family}
+	}
+
+	return &cslName{Family: n.family, Given: n.given, Suffix: n.suffix}
+}
+
+func init() {
+	// mapping of citation formats (citation part "format") to CSL item type
+	cslTypesMap = make(map[string]string)
+
+	cslTypesMap["art"] = cslTypeGraphic
+	cslTypesMap["article"] = cslTypeArticleJournal
+	cslTypesMap["book"] = cslTypeBook
+	cslTypesMap["government_document"] = cslTypeReport
+	cslTypesMap["journal"] = cslTypeArticleJournal
+	cslTypesMap["manuscript"] = cslTypeManuscript
+	cslTypesMap["map"] = cslTypeMap
+	cslTypesMap["music"] = cslTypeSong
+	cslTypesMap["news"] = cslTypeArticleNewspaper
+	cslTypesMap["sound"] = cslTypeSong
+	cslTypesMap["thesis"] = cslTypeThesis
+	cslTypesMap["video"] = cslTypeMotionPicture
+}
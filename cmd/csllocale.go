@@ -0,0 +1,212 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+)
+
+// CSL term forms
+const cslFormLong = "long"
+const cslFormShort = "short"
+const cslFormSymbol = "symbol"
+const cslFormVerb = "verb"
+const cslFormVerbShort = "verb-short"
+
+type cslTerm struct {
+	single   string
+	multiple string
+}
+
+// terms, keyed by name and form
+type cslTerms map[string]cslTerm
+
+// built-in en-US locale, used unless overridden by a style
+var cslDefaultTerms cslTerms
+var cslDefaultDates map[string]*cslNode
+
+// localized date formats, in the same form as a style's locale element
+const cslDefaultDatesXML = `<locale>
+  <date form="text">
+    <date-part name="month" suffix=" "/>
+    <date-part name="day" suffix=", "/>
+    <date-part name="year"/>
+  </date>
+  <date form="numeric">
+    <date-part name="month" form="numeric-leading-zeros" suffix="/"/>
+    <date-part name="day" form="numeric-leading-zeros" suffix="/"/>
+    <date-part name="year"/>
+  </date>
+</locale>`
+
+func cslTermKey(name, form string) string {
+	return name + "/" + form
+}
+
+func (t cslTerms) set(name, form, single, multiple string) {
+	t[cslTermKey(name, form)] = cslTerm{single: single, multiple: multiple}
+}
+
+func (t cslTerms) lookup(name, form string, plural bool) string {
+	// fall back through the less specific forms, per the CSL specification
+	forms := []string{form}
+
+	switch form {
+	case cslFormVerbShort:
+		forms = append(forms, cslFormVerb, cslFormLong)
+	case cslFormSymbol:
+		forms = append(forms, cslFormShort, cslFormLong)
+	case cslFormShort, cslFormVerb:
+		forms = append(forms, cslFormLong)
+	}
+
+	for _, f := range forms {
+		if term, ok := t[cslTermKey(name, f)]; ok == true {
+			if plural == true && term.multiple != "" {
+				return term.multiple
+			}
+
+			return term.single
+		}
+	}
+
+	return ""
+}
+
+func (t cslTerms) merge(locale *cslNode) cslTerms {
+	merged := make(cslTerms)
+
+	for k, v := range t {
+		merged[k] = v
+	}
+
+	if locale == nil {
+		return merged
+	}
+
+	for _, terms := range locale.children("terms") {
+		for _, term := range terms.children("term") {
+			form := term.attr("form")
+			if form == "" {
+				form = cslFormLong
+			}
+
+			single := term.Text
+			multiple := ""
+
+			if s := term.child("single"); s != nil {
+				single = s.Text
+			}
+
+			if m := term.child("multiple"); m != nil {
+				multiple = m.Text
+			}
+
+			merged.set(term.attr("name"), form, single, multiple)
+		}
+	}
+
+	return merged
+}
+
+func init() {
+	t := make(cslTerms)
+
+	t.set("and", cslFormLong, "and", "")
+	t.set("and", cslFormSymbol, "&", "")
+	t.set("and others", cslFormLong, "and others", "")
+	t.set("anonymous", cslFormLong, "anonymous", "")
+	t.set("anonymous", cslFormShort, "anon.", "")
+	t.set("at", cslFormLong, "at", "")
+	t.set("available at", cslFormLong, "available at", "")
+	t.set("by", cslFormLong, "by", "")
+	t.set("circa", cslFormLong, "circa", "")
+	t.set("circa", cslFormShort, "c.", "")
+	t.set("cited", cslFormLong, "cited", "")
+	t.set("et-al", cslFormLong, "et al.", "")
+	t.set("from", cslFormLong, "from", "")
+	t.set("ibid", cslFormLong, "ibid.", "")
+	t.set("in", cslFormLong, "in", "")
+	t.set("in press", cslFormLong, "in press", "")
+	t.set("internet", cslFormLong, "internet", "")
+	t.set("no date", cslFormLong, "no date", "")
+	t.set("no date", cslFormShort, "n.d.", "")
+	t.set("online", cslFormLong, "online", "")
+	t.set("presented at", cslFormLong, "presented at the", "")
+	t.set("accessed", cslFormLong, "accessed", "")
+	t.set("retrieved", cslFormLong, "retrieved", "")
+	t.set("scale", cslFormLong, "scale", "")
+	t.set("version", cslFormLong, "version", "")
+
+	t.set("open-quote", cslFormLong, "“", "")
+	t.set("close-quote", cslFormLong, "”", "")
+	t.set("open-inner-quote", cslFormLong, "‘", "")
+	t.set("close-inner-quote", cslFormLong, "’", "")
+	t.set("page-range-delimiter", cslFormLong, "–", "")
+
+	// locators and number variables
+	t.set("book", cslFormLong, "book", "books")
+	t.set("book", cslFormShort, "bk.", "bks.")
+	t.set("chapter", cslFormLong, "chapter", "chapters")
+	t.set("chapter", cslFormShort, "chap.", "chaps.")
+	t.set("edition", cslFormLong, "edition", "editions")
+	t.set("edition", cslFormShort, "ed.", "eds.")
+	t.set("issue", cslFormLong, "issue", "issues")
+	t.set("issue", cslFormShort, "no.", "nos.")
+	t.set("number", cslFormLong, "number", "numbers")
+	t.set("number", cslFormShort, "no.", "nos.")
+	t.set("page", cslFormLong, "page", "pages")
+	t.set("page", cslFormShort, "p.", "pp.")
+	t.set("paragraph", cslFormLong, "paragraph", "paragraphs")
+	t.set("paragraph", cslFormShort, "para.", "paras.")
+	t.set("section", cslFormLong, "section", "sections")
+	t.set("section", cslFormShort, "sec.", "secs.")
+	t.set("volume", cslFormLong, "volume", "volumes")
+	t.set("volume", cslFormShort, "vol.", "vols.")
+
+	// roles
+	t.set("compiler", cslFormLong, "compiler", "compilers")
+	t.set("compiler", cslFormShort, "comp.", "comps.")
+	t.set("compiler", cslFormVerb, "compiled by", "")
+	t.set("compiler", cslFormVerbShort, "comp.", "")
+	t.set("contributor", cslFormLong, "contributor", "contributors")
+	t.set("contributor", cslFormShort, "contrib.", "contribs.")
+	t.set("contributor", cslFormVerb, "with", "")
+	t.set("director", cslFormLong, "director", "directors")
+	t.set("director", cslFormShort, "dir.", "dirs.")
+	t.set("director", cslFormVerb, "directed by", "")
+	t.set("editor", cslFormLong, "editor", "editors")
+	t.set("editor", cslFormShort, "ed.", "eds.")
+	t.set("editor", cslFormVerb, "edited by", "")
+	t.set("editor", cslFormVerbShort, "ed.", "")
+	t.set("editortranslator", cslFormLong, "editor & translator", "editors & translators")
+	t.set("editortranslator", cslFormShort, "ed. & tran.", "eds. & trans.")
+	t.set("editortranslator", cslFormVerb, "edited & translated by", "")
+	t.set("translator", cslFormLong, "translator", "translators")
+	t.set("translator", cslFormShort, "tran.", "trans.")
+	t.set("translator", cslFormVerb, "translated by", "")
+	t.set("translator", cslFormVerbShort, "trans.", "")
+
+	// months
+	for m := 1; m <= 12; m++ {
+		name := monthName(m)
+		short := name
+		if len(short) > 3 {
+			short = short[:3] + "."
+		}
+
+		t.set(fmt.Sprintf("month-%02d", m), cslFormLong, name, "")
+		t.set(fmt.Sprintf("month-%02d", m), cslFormShort, short, "")
+	}
+
+	cslDefaultTerms = t
+
+	var locale cslNode
+	if err := xml.Unmarshal([]byte(cslDefaultDatesXML), &locale); err != nil {
+		panic(fmt.Sprintf("invalid default CSL dates: %s", err.Error()))
+	}
+
+	cslDefaultDates = make(map[string]*cslNode)
+	for _, date := range locale.children("date") {
+		cslDefaultDates[date.attr("form")] = date
+	}
+}
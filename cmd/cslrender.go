@@ -0,0 +1,1141 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// tracks variables referenced while rendering, for group suppression and substitution
+type cslVarStats struct {
+	called   int
+	rendered int
+	vars     []string
+}
+
+type cslRenderer struct {
+	style      *cslStyle
+	context    *cslNode // citation or bibliography element
+	item       *cslItem
+	html       bool
+	vars       map[string]string
+	names      map[string][]cslName
+	dates      map[string]*cslDate
+	suppressed map[string]bool
+	stats      []*cslVarStats
+}
+
+type cslREs struct {
+	numeric     *regexp.Regexp
+	plural      *regexp.Regexp
+	markup      *regexp.Regexp
+	words       *regexp.Regexp
+	trailingTag *regexp.Regexp
+}
+
+var cslRE cslREs
+var cslStopWords map[string]bool
+var cslLongOrdinals []string
+var cslEscapes *strings.Replacer
+
+// name options that may be set on cs:name, or inherited from cs:citation/cs:bibliography/cs:style
+var cslInheritableNameAttrs map[string]string
+
+func newCSLRenderer(style *cslStyle, context *cslNode, item *cslItem, html bool) *cslRenderer {
+	r := cslRenderer{}
+
+	r.style = style
+	r.context = context
+	r.item = item
+	r.html = html
+	r.suppressed = make(map[string]bool)
+	r.stats = []*cslVarStats{{}}
+
+	r.vars = map[string]string{
+		"abstract":         item.Abstract,
+		"citation-number":  "1",
+		"collection-title": item.CollectionTitle,
+		"container-title":  item.ContainerTitle,
+		"DOI":              item.DOI,
+		"edition":          item.Edition,
+		"genre":            item.Genre,
+		"ISBN":             item.ISBN,
+		"ISSN":             item.ISSN,
+		"issue":            item.Issue,
+		"keyword":          item.Keyword,
+		"language":         item.Language,
+		"page":             item.Page,
+		"page-first":       firstElementOf(strings.Split(item.Page, "-")),
+		"publisher":        item.Publisher,
+		"publisher-place":  item.PublisherPlace,
+		"title":            item.Title,
+		"URL":              item.URL,
+		"volume":           item.Volume,
+	}
+
+	r.names = map[string][]cslName{
+		"author":      item.Author,
+		"compiler":    item.Compiler,
+		"contributor": item.Contributor,
+		"editor":      item.Editor,
+		"translator":  item.Translator,
+	}
+
+	r.dates = map[string]*cslDate{
+		"issued": item.Issued,
+	}
+
+	return &r
+}
+
+func (r *cslRenderer) render() string {
+	if r.context == nil {
+		return ""
+	}
+
+	layout := r.context.child("layout")
+	if layout == nil {
+		return ""
+	}
+
+	res := r.renderChildren(layout.Nodes, "")
+
+	return strings.TrimSpace(r.wrap(layout, res))
+}
+
+func (r *cslRenderer) renderChildren(nodes []*cslNode, delimiter string) string {
+	res := ""
+
+	for _, node := range nodes {
+		out := r.renderNode(node)
+
+		if out == "" {
+			continue
+		}
+
+		if res != "" {
+			res = r.append(res, r.escape(delimiter))
+		}
+
+		res = r.append(res, out)
+	}
+
+	return res
+}
+
+func (r *cslRenderer) renderNode(n *cslNode) string {
+	switch n.name() {
+	case "text":
+		return r.renderText(n)
+	case "number":
+		return r.renderNumber(n)
+	case "label":
+		return r.renderLabel(n)
+	case "names":
+		return r.renderNames(n, nil)
+	case "date":
+		return r.renderDate(n)
+	case "group":
+		return r.renderGroup(n)
+	case "choose":
+		return r.renderChoose(n)
+	}
+
+	return ""
+}
+
+// variable tracking
+
+func (r *cslRenderer) pushStats() {
+	r.stats = append(r.stats, &cslVarStats{})
+}
+
+func (r *cslRenderer) popStats() *cslVarStats {
+	top := r.stats[len(r.stats)-1]
+	r.stats = r.stats[:len(r.stats)-1]
+
+	parent := r.stats[len(r.stats)-1]
+	parent.called += top.called
+	parent.rendered += top.rendered
+	parent.vars = append(parent.vars, top.vars...)
+
+	return top
+}
+
+func (r *cslRenderer) noteVariable(name string, rendered bool) {
+	top := r.stats[len(r.stats)-1]
+
+	top.called++
+	top.vars = append(top.vars, name)
+
+	if rendered == true {
+		top.rendered++
+	}
+}
+
+func (r *cslRenderer) variable(name, form string) string {
+	if r.suppressed[name] == true {
+		return ""
+	}
+
+	if form == cslFormShort {
+		if val := r.vars[name+"-short"]; val != "" {
+			return val
+		}
+	}
+
+	return r.vars[name]
+}
+
+func (r *cslRenderer) hasVariable(name string) bool {
+	if r.vars[name] != "" || len(r.names[name]) > 0 {
+		return true
+	}
+
+	if d := r.dates[name]; d != nil && (len(d.DateParts) > 0 || d.Literal != "") {
+		return true
+	}
+
+	return false
+}
+
+// rendering elements
+
+func (r *cslRenderer) renderText(n *cslNode) string {
+	switch {
+	case n.hasAttr("variable"):
+		name := n.attr("variable")
+		val := r.variable(name, n.attr("form"))
+
+		r.noteVariable(name, val != "")
+
+		if val == "" {
+			return ""
+		}
+
+		if name == "page" {
+			val = r.pageRange(val)
+		}
+
+		return r.wrap(n, r.escape(val))
+
+	case n.hasAttr("macro"):
+		macro := r.style.macros[n.attr("macro")]
+		if macro == nil {
+			return ""
+		}
+
+		// macros behave as implicit groups
+		r.pushStats()
+		out := r.renderChildren(macro.Nodes, "")
+		stats := r.popStats()
+
+		if out == "" || (stats.called > 0 && stats.rendered == 0) {
+			return ""
+		}
+
+		return r.wrap(n, out)
+
+	case n.hasAttr("term"):
+		form := n.attr("form")
+		if form == "" {
+			form = cslFormLong
+		}
+
+		val := r.style.terms.lookup(n.attr("term"), form, n.attr("plural") == "true")
+		if val == "" {
+			return ""
+		}
+
+		return r.wrap(n, r.escape(val))
+
+	case n.hasAttr("value"):
+		return r.wrap(n, r.escape(n.attr("value")))
+	}
+
+	return ""
+}
+
+func (r *cslRenderer) renderNumber(n *cslNode) string {
+	name := n.attr("variable")
+	val := r.variable(name, "")
+
+	r.noteVariable(name, val != "")
+
+	if val == "" {
+		return ""
+	}
+
+	if num, err := strconv.Atoi(strings.TrimSpace(val)); err == nil {
+		switch n.attr("form") {
+		case "ordinal":
+			val = cslOrdinal(num)
+		case "long-ordinal":
+			val = cslLongOrdinal(num)
+		case "roman":
+			val = cslRoman(num)
+		}
+	}
+
+	if name == "page" {
+		val = r.pageRange(val)
+	}
+
+	return r.wrap(n, r.escape(val))
+}
+
+func (r *cslRenderer) renderLabel(n *cslNode) string {
+	name := n.attr("variable")
+	val := r.variable(name, "")
+
+	if val == "" {
+		return ""
+	}
+
+	plural := false
+	switch n.attr("plural") {
+	case "always":
+		plural = true
+	case "never":
+		plural = false
+	default:
+		plural = cslRE.plural.MatchString(val)
+	}
+
+	return r.renderTerm(n, name, plural)
+}
+
+func (r *cslRenderer) renderTerm(n *cslNode, name string, plural bool) string {
+	form := n.attr("form")
+	if form == "" {
+		form = cslFormLong
+	}
+
+	term := r.style.terms.lookup(name, form, plural)
+	if term == "" {
+		return ""
+	}
+
+	return r.wrap(n, r.escape(term))
+}
+
+func (r *cslRenderer) renderGroup(n *cslNode) string {
+	r.pushStats()
+	out := r.renderChildren(n.Nodes, n.attr("delimiter"))
+	stats := r.popStats()
+
+	// groups are suppressed if they reference variables, none of which are present
+	if out == "" || (stats.called > 0 && stats.rendered == 0) {
+		return ""
+	}
+
+	return r.wrap(n, out)
+}
+
+func (r *cslRenderer) renderChoose(n *cslNode) string {
+	for _, branch := range n.Nodes {
+		switch branch.name() {
+		case "if", "else-if":
+			if r.matches(branch) == true {
+				return r.renderChildren(branch.Nodes, "")
+			}
+
+		case "else":
+			return r.renderChildren(branch.Nodes, "")
+		}
+	}
+
+	return ""
+}
+
+func (r *cslRenderer) matches(n *cslNode) bool {
+	var results []bool
+
+	for _, attr := range n.Attrs {
+		for _, val := range strings.Fields(attr.Value) {
+			switch attr.Name.Local {
+			case "type":
+				results = append(results, r.item.Type == val)
+			case "variable":
+				results = append(results, r.hasVariable(val))
+			case "is-numeric":
+				results = append(results, cslRE.numeric.MatchString(r.vars[val]))
+			case "position":
+				// a single bibliographic entry is always the first cite
+				results = append(results, val == "first")
+			case "is-uncertain-date", "locator", "disambiguate":
+				results = append(results, false)
+			}
+		}
+	}
+
+	match := n.attr("match")
+
+	for _, result := range results {
+		switch {
+		case match == "any" && result == true:
+			return true
+		case match == "none" && result == true:
+			return false
+		case match != "any" && match != "none" && result == false:
+			return false
+		}
+	}
+
+	return match != "any" || len(results) == 0
+}
+
+func (r *cslRenderer) renderNames(n *cslNode, parent *cslNode) string {
+	// names elements within a substitute inherit the options of the original names element
+	opts := n
+	if parent != nil && n.child("name") == nil {
+		opts = parent
+	}
+
+	var lists []string
+
+	for _, name := range strings.Fields(n.attr("variable")) {
+		names := r.names[name]
+		if r.suppressed[name] == true {
+			names = nil
+		}
+
+		r.noteVariable(name, len(names) > 0)
+
+		if len(names) == 0 {
+			continue
+		}
+
+		lists = append(lists, r.renderNameList(opts, name, names))
+	}
+
+	if len(lists) > 0 {
+		delimiter := n.attr("delimiter")
+		if n.hasAttr("delimiter") == false {
+			delimiter = r.inheritedAttr("names-delimiter")
+		}
+
+		return r.wrap(n, strings.Join(lists, r.escape(delimiter)))
+	}
+
+	substitute := n.child("substitute")
+	if substitute == nil {
+		return ""
+	}
+
+	// first non-empty substitute wins, and its variables are not repeated elsewhere
+	for _, sub := range substitute.Nodes {
+		r.pushStats()
+
+		out := ""
+		if sub.name() == "names" {
+			out = r.renderNames(sub, opts)
+		} else {
+			out = r.renderNode(sub)
+		}
+
+		stats := r.popStats()
+
+		if out != "" {
+			for _, v := range stats.vars {
+				r.suppressed[v] = true
+			}
+
+			return r.wrap(n, out)
+		}
+	}
+
+	return ""
+}
+
+func (r *cslRenderer) inheritedAttr(attr string) string {
+	for _, n := range []*cslNode{r.context, r.style.root} {
+		if n != nil && n.hasAttr(attr) == true {
+			return n.attr(attr)
+		}
+	}
+
+	return ""
+}
+
+func (r *cslRenderer) nameAttr(n *cslNode, attr string) string {
+	return r.nameAttrWithFallback(n, attr, "")
+}
+
+func (r *cslRenderer) nameAttrWithFallback(n *cslNode, attr, fallback string) string {
+	if n != nil && n.hasAttr(attr) == true {
+		return n.attr(attr)
+	}
+
+	inherited := cslInheritableNameAttrs[attr]
+
+	for _, node := range []*cslNode{r.context, r.style.root} {
+		if node != nil && inherited != "" && node.hasAttr(inherited) == true {
+			return node.attr(inherited)
+		}
+	}
+
+	return fallback
+}
+
+func (r *cslRenderer) renderNameList(n *cslNode, role string, names []cslName) string {
+	nameNode := n.child("name")
+	etAlNode := n.child("et-al")
+	labelNode := n.child("label")
+
+	form := r.nameAttr(nameNode, "form")
+
+	delimiter := r.nameAttrWithFallback(nameNode, "delimiter", ", ")
+
+	shown := names
+	truncated := false
+
+	etAlMin, _ := strconv.Atoi(r.nameAttr(nameNode, "et-al-min"))
+	etAlUseFirst, _ := strconv.Atoi(r.nameAttr(nameNode, "et-al-use-first"))
+
+	if etAlMin > 0 && etAlUseFirst > 0 && len(names) >= etAlMin && etAlUseFirst < len(names) {
+		shown = names[:etAlUseFirst]
+		truncated = true
+	}
+
+	if form == "count" {
+		return strconv.Itoa(len(shown))
+	}
+
+	var formatted []string
+	var inverted []bool
+
+	asSortOrder := r.nameAttr(nameNode, "name-as-sort-order")
+
+	for i, name := range shown {
+		sortOrder := asSortOrder == "all" || (asSortOrder == "first" && i == 0)
+		formatted = append(formatted, r.renderName(nameNode, name, form, sortOrder))
+		inverted = append(inverted, sortOrder && name.Literal == "")
+	}
+
+	res := ""
+
+	and := ""
+	switch r.nameAttr(nameNode, "and") {
+	case "text":
+		and = r.style.terms.lookup("and", cslFormLong, false)
+	case "symbol":
+		and = "&"
+	}
+
+	precedesLast := r.nameAttr(nameNode, "delimiter-precedes-last")
+
+	for i, name := range formatted {
+		switch {
+		case i == 0:
+			res = name
+
+		case i == len(formatted)-1 && truncated == false && and != "":
+			useDelimiter := false
+
+			switch precedesLast {
+			case "always":
+				useDelimiter = true
+			case "never":
+				useDelimiter = false
+			case "after-inverted-name":
+				useDelimiter = inverted[i-1]
+			default:
+				useDelimiter = len(formatted) > 2
+			}
+
+			if useDelimiter == true {
+				res += r.escape(delimiter) + r.escape(and) + " " + name
+			} else {
+				res += " " + r.escape(and) + " " + name
+			}
+
+		default:
+			res += r.escape(delimiter) + name
+		}
+	}
+
+	if truncated == true {
+		useLast := r.nameAttr(nameNode, "et-al-use-last") == "true"
+
+		switch {
+		case useLast == true:
+			last := names[len(names)-1]
+			lastSort := asSortOrder == "all"
+			res += r.escape(delimiter) + "… " + r.renderName(nameNode, last, form, lastSort)
+
+		default:
+			term := "et-al"
+			if etAlNode != nil && etAlNode.attr("term") != "" {
+				term = etAlNode.attr("term")
+			}
+
+			etAl := r.escape(r.style.terms.lookup(term, cslFormLong, false))
+			if etAlNode != nil {
+				etAl = r.wrap(etAlNode, etAl)
+			}
+
+			precedesEtAl := r.nameAttr(nameNode, "delimiter-precedes-et-al")
+
+			useDelimiter := false
+			switch precedesEtAl {
+			case "always":
+				useDelimiter = true
+			case "never":
+				useDelimiter = false
+			case "after-inverted-name":
+				useDelimiter = inverted[len(inverted)-1]
+			default:
+				useDelimiter = len(shown) > 1
+			}
+
+			if useDelimiter == true {
+				res += r.escape(delimiter) + etAl
+			} else {
+				res += " " + etAl
+			}
+		}
+	}
+
+	if nameNode != nil {
+		res = r.wrap(nameNode, res)
+	}
+
+	if labelNode == nil {
+		return res
+	}
+
+	label := r.renderTerm(labelNode, role, len(names) > 1)
+
+	// labels may precede or follow the names
+	for _, node := range n.Nodes {
+		switch node {
+		case labelNode:
+			return label + res
+		case nameNode:
+			return res + label
+		}
+	}
+
+	return res + label
+}
+
+func (r *cslRenderer) renderName(n *cslNode, name cslName, form string, sortOrder bool) string {
+	if name.Literal != "" {
+		return r.escape(name.Literal)
+	}
+
+	family := r.escape(name.Family)
+	given := name.Given
+
+	initializeWith := r.nameAttr(n, "initialize-with")
+	if initializeWith != "" && r.nameAttr(n, "initialize") != "false" {
+		given = cslInitialize(given, initializeWith)
+	}
+
+	given = r.escape(given)
+	suffix := r.escape(name.Suffix)
+
+	if n != nil {
+		for _, part := range n.children("name-part") {
+			switch part.attr("name") {
+			case "family":
+				family = r.wrap(part, family)
+			case "given":
+				if given != "" {
+					given = r.wrap(part, given)
+				}
+			}
+		}
+	}
+
+	if form == cslFormShort || given == "" {
+		return family
+	}
+
+	if sortOrder == true {
+		sortSeparator := r.nameAttrWithFallback(n, "sort-separator", ", ")
+
+		res := family + r.escape(sortSeparator) + given
+		if suffix != "" {
+			res += r.escape(sortSeparator) + suffix
+		}
+
+		return res
+	}
+
+	res := given + " " + family
+	if suffix != "" {
+		res += ", " + suffix
+	}
+
+	return res
+}
+
+func (r *cslRenderer) renderDate(n *cslNode) string {
+	name := n.attr("variable")
+
+	d := r.dates[name]
+	if r.suppressed[name] == true {
+		d = nil
+	}
+
+	hasDate := d != nil && ((len(d.DateParts) > 0 && len(d.DateParts[0]) > 0) || d.Literal != "")
+
+	r.noteVariable(name, hasDate)
+
+	if hasDate == false {
+		return ""
+	}
+
+	if d.Literal != "" && len(d.DateParts) == 0 {
+		return r.wrap(n, r.escape(d.Literal))
+	}
+
+	parts := d.DateParts[0]
+	values := map[string]int{"year": parts[0]}
+
+	if len(parts) > 1 {
+		values["month"] = parts[1]
+	}
+
+	if len(parts) > 2 {
+		values["day"] = parts[2]
+	}
+
+	var dateParts []*cslNode
+	delimiter := n.attr("delimiter")
+
+	if form := n.attr("form"); form != "" {
+		// localized date, optionally limited to certain parts
+		locale := r.style.dates[form]
+		if locale == nil {
+			return ""
+		}
+
+		delimiter = locale.attr("delimiter")
+
+		include := map[string]bool{"year": true, "month": true, "day": true}
+		switch n.attr("date-parts") {
+		case "year-month":
+			include["day"] = false
+		case "year":
+			include["month"] = false
+			include["day"] = false
+		}
+
+		for _, part := range locale.children("date-part") {
+			if include[part.attr("name")] == true {
+				dateParts = append(dateParts, cslMergeDatePart(part, n))
+			}
+		}
+	} else {
+		dateParts = n.children("date-part")
+	}
+
+	res := ""
+
+	for _, part := range dateParts {
+		out := r.renderDatePart(part, values[part.attr("name")])
+
+		if out == "" {
+			continue
+		}
+
+		if res != "" {
+			res = r.append(res, r.escape(delimiter))
+		}
+
+		res = r.append(res, out)
+	}
+
+	if res == "" {
+		return ""
+	}
+
+	return r.wrap(n, res)
+}
+
+func (r *cslRenderer) renderDatePart(n *cslNode, val int) string {
+	if val == 0 {
+		return ""
+	}
+
+	form := n.attr("form")
+	res := ""
+
+	switch n.attr("name") {
+	case "year":
+		res = strconv.Itoa(val)
+		if form == cslFormShort {
+			res = fmt.Sprintf("%02d", val%100)
+		}
+
+	case "month":
+		switch form {
+		case "numeric":
+			res = strconv.Itoa(val)
+		case "numeric-leading-zeros":
+			res = fmt.Sprintf("%02d", val)
+		case cslFormShort:
+			res = r.style.terms.lookup(fmt.Sprintf("month-%02d", val), cslFormShort, false)
+		default:
+			res = r.style.terms.lookup(fmt.Sprintf("month-%02d", val), cslFormLong, false)
+		}
+
+	case "day":
+		switch form {
+		case "numeric-leading-zeros":
+			res = fmt.Sprintf("%02d", val)
+		case "ordinal":
+			res = cslOrdinal(val)
+		default:
+			res = strconv.Itoa(val)
+		}
+	}
+
+	return r.wrap(n, r.escape(res))
+}
+
+func cslMergeDatePart(part *cslNode, date *cslNode) *cslNode {
+	// date-part attributes in the style (other than affixes) override those of the locale
+	var override *cslNode
+
+	for _, p := range date.children("date-part") {
+		if p.attr("name") == part.attr("name") {
+			override = p
+		}
+	}
+
+	if override == nil {
+		return part
+	}
+
+	merged := cslNode{XMLName: part.XMLName}
+
+	for _, a := range part.Attrs {
+		if override.hasAttr(a.Name.Local) == false || a.Name.Local == "prefix" || a.Name.Local == "suffix" {
+			merged.Attrs = append(merged.Attrs, a)
+		}
+	}
+
+	for _, a := range override.Attrs {
+		if a.Name.Local != "prefix" && a.Name.Local != "suffix" {
+			merged.Attrs = append(merged.Attrs, a)
+		}
+	}
+
+	return &merged
+}
+
+// output formatting
+
+func (r *cslRenderer) escape(s string) string {
+	if r.html == false {
+		return s
+	}
+
+	return cslEscapes.Replace(s)
+}
+
+func (r *cslRenderer) pageRange(s string) string {
+	delimiter := r.style.terms.lookup("page-range-delimiter", cslFormLong, false)
+
+	return strings.ReplaceAll(s, "-", delimiter)
+}
+
+func (r *cslRenderer) wrap(n *cslNode, s string) string {
+	// applies, in order: text case, period stripping, quotes, font formatting, affixes, display
+	if s == "" {
+		return ""
+	}
+
+	res := cslTextCase(s, n.attr("text-case"))
+
+	if n.attr("strip-periods") == "true" {
+		res = cslMapText(res, func(t string) string {
+			return strings.ReplaceAll(t, ".", "")
+		})
+	}
+
+	if n.attr("quotes") == "true" {
+		open := r.style.terms.lookup("open-quote", cslFormLong, false)
+		close := r.style.terms.lookup("close-quote", cslFormLong, false)
+
+		res = open + res + close
+	}
+
+	if r.html == true {
+		switch n.attr("font-style") {
+		case "italic", "oblique":
+			res = "<em>" + res + "</em>"
+		}
+
+		if n.attr("font-variant") == "small-caps" {
+			res = `<span style="font-variant: small-caps;">` + res + "</span>"
+		}
+
+		if n.attr("font-weight") == "bold" {
+			res = "<strong>" + res + "</strong>"
+		}
+
+		if n.attr("text-decoration") == "underline" {
+			res = `<span style="text-decoration: underline;">` + res + "</span>"
+		}
+
+		switch n.attr("vertical-align") {
+		case "sup":
+			res = "<sup>" + res + "</sup>"
+		case "sub":
+			res = "<sub>" + res + "</sub>"
+		}
+	}
+
+	res = r.escape(n.attr("prefix")) + res
+	res = r.append(res, r.escape(n.attr("suffix")))
+
+	if display := n.attr("display"); display != "" {
+		if r.html == true {
+			res = fmt.Sprintf(`<div class="csl-%s">%s</div>`, display, res)
+		} else if display == "left-margin" {
+			res += " "
+		}
+	}
+
+	return res
+}
+
+func (r *cslRenderer) append(s, t string) string {
+	// american style: periods and commas following a quotation go inside the quotes
+	if r.style.punctuationInQuote == true && (strings.HasPrefix(t, ".") || strings.HasPrefix(t, ",")) {
+		close := r.style.terms.lookup("close-quote", cslFormLong, false)
+		visible := cslRE.trailingTag.ReplaceAllString(s, "")
+
+		if close != "" && strings.HasSuffix(visible, close) == true {
+			tags := s[len(visible):]
+			quoted := cslAppend(strings.TrimSuffix(visible, close), t[:1])
+
+			return cslAppend(quoted+close+tags, t[1:])
+		}
+	}
+
+	return cslAppend(s, t)
+}
+
+func cslAppend(s, t string) string {
+	// joins two strings, collapsing duplicate periods at the boundary (ignoring markup)
+	if s == "" {
+		return t
+	}
+
+	if t == "" {
+		return s
+	}
+
+	visible := cslRE.trailingTag.ReplaceAllString(s, "")
+
+	if strings.HasPrefix(t, ".") && (strings.HasSuffix(visible, ".") || strings.HasSuffix(visible, "?") || strings.HasSuffix(visible, "!")) {
+		t = t[1:]
+	}
+
+	return s + t
+}
+
+func cslMapText(s string, fn func(string) string) string {
+	// applies fn to the text portions of s, leaving any markup or entities intact
+	var b strings.Builder
+
+	last := 0
+
+	for _, loc := range cslRE.markup.FindAllStringIndex(s, -1) {
+		b.WriteString(fn(s[last:loc[0]]))
+		b.WriteString(s[loc[0]:loc[1]])
+		last = loc[1]
+	}
+
+	b.WriteString(fn(s[last:]))
+
+	return b.String()
+}
+
+func cslTextCase(s, textCase string) string {
+	switch textCase {
+	case "lowercase":
+		return cslMapText(s, strings.ToLower)
+
+	case "uppercase":
+		return cslMapText(s, strings.ToUpper)
+
+	case "capitalize-first", "sentence":
+		done := false
+
+		return cslMapText(s, func(t string) string {
+			if done == true || t == "" {
+				return t
+			}
+
+			done = true
+
+			return cslUpperFirst(t)
+		})
+
+	case "capitalize-all", "title":
+		// the first word of the title (or of a subtitle) is always capitalized
+		first := true
+
+		return cslMapText(s, func(t string) string {
+			var b strings.Builder
+
+			last := 0
+
+			for _, loc := range cslRE.words.FindAllStringIndex(t, -1) {
+				between := t[last:loc[0]]
+				word := t[loc[0]:loc[1]]
+
+				if strings.ContainsAny(between, ":?!") == true {
+					first = true
+				}
+
+				isFirst := first
+				first = false
+
+				b.WriteString(between)
+
+				// mixed-case words (e.g. "iPhone") are left as they are
+				switch {
+				case word != strings.ToLower(word):
+				case textCase == "title" && isFirst == false && cslStopWords[word] == true:
+				default:
+					word = cslUpperFirst(word)
+				}
+
+				b.WriteString(word)
+
+				last = loc[1]
+			}
+
+			b.WriteString(t[last:])
+
+			return b.String()
+		})
+	}
+
+	return s
+}
+
+func cslUpperFirst(s string) string {
+	r, size := utf8.DecodeRuneInString(s)
+
+	if r == utf8.RuneError {
+		return s
+	}
+
+	return string(unicode.ToUpper(r)) + s[size:]
+}
+
+func cslOrdinal(n int) string {
+	suffix := "th"
+
+	switch {
+	case n%100 >= 11 && n%100 <= 13:
+	case n%10 == 1:
+		suffix = "st"
+	case n%10 == 2:
+		suffix = "nd"
+	case n%10 == 3:
+		suffix = "rd"
+	}
+
+	return fmt.Sprintf("%d%s", n, suffix)
+}
+
+func cslLongOrdinal(n int) string {
+	if n >= 1 && n <= len(cslLongOrdinals) {
+		return cslLongOrdinals[n-1]
+	}
+
+	return cslOrdinal(n)
+}
+
+func cslRoman(n int) string {
+	if n <= 0 || n >= 4000 {
+		return strconv.Itoa(n)
+	}
+
+	values := []int{1000, 900, 500, 400, 100, 90, 50, 40, 10, 9, 5, 4, 1}
+	numerals := []string{"m", "cm", "d", "cd", "c", "xc", "l", "xl", "x", "ix", "v", "iv", "i"}
+
+	var b strings.Builder
+
+	for i, v := range values {
+		for n >= v {
+			b.WriteString(numerals[i])
+			n -= v
+		}
+	}
+
+	return b.String()
+}
+
+func cslInitialize(given, with string) string {
+	// "John Ronald" => "J. R." (for initialize-with=". ")
+	var initials []string
+
+	for _, word := range strings.Fields(given) {
+		var parts []string
+
+		for _, part := range strings.Split(word, "-") {
+			r, _ := utf8.DecodeRuneInString(part)
+			if r == utf8.RuneError {
+				continue
+			}
+
+			parts = append(parts, strings.TrimSpace(string(r)+with))
+		}
+
+		initials = append(initials, strings.Join(parts, "-"))
+	}
+
+	joiner := " "
+	if strings.HasSuffix(with, " ") == false {
+		joiner = ""
+	}
+
+	return strings.Join(initials, joiner)
+}
+
+func init() {
+	cslRE.numeric = regexp.MustCompile(`^\s*[a-zA-Z]?\d+[a-zA-Z]?(\s*[-–&,]\s*[a-zA-Z]?\d+[a-zA-Z]?)*\s*$`)
+	cslRE.plural = regexp.MustCompile(`\d\s*[-–&,]\s*\d`)
+	cslRE.markup = regexp.MustCompile(`<[^>]*>|&[a-zA-Z0-9#]+;`)
+	cslRE.words = regexp.MustCompile(`[\pL\pN'’]+`)
+	cslRE.trailingTag = regexp.MustCompile(`(<[^>]*>)+$`)
+
+	cslStopWords = make(map[string]bool)
+
+	for _, s := range []string{"a", "an", "and", "as", "at", "but", "by", "down", "for", "from", "in", "into", "nor", "of", "on", "onto", "or", "over", "so", "the", "till", "to", "up", "via", "with", "yet"} {
+		cslStopWords[s] = true
+	}
+
+	cslLongOrdinals = []string{"first", "second", "third", "fourth", "fifth", "sixth", "seventh", "eighth", "ninth", "tenth"}
+
+	cslEscapes = strings.NewReplacer(`&`, `&amp;`, `<`, `&lt;`, `>`, `&gt;`)
+
+	cslInheritableNameAttrs = map[string]string{
+		"and":                      "and",
+		"delimiter":                "name-delimiter",
+		"delimiter-precedes-et-al": "delimiter-precedes-et-al",
+		"delimiter-precedes-last":  "delimiter-precedes-last",
+		"et-al-min":                "et-al-min",
+		"et-al-use-first":          "et-al-use-first",
+		"et-al-use-last":           "et-al-use-last",
+		"form":                     "name-form",
+		"initialize":               "initialize",
+		"initialize-with":          "initialize-with",
+		"name-as-sort-order":       "name-as-sort-order",
+		"sort-separator":           "sort-separator",
+	}
+}
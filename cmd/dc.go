@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"strings"
+
+	"github.com/microcosm-cc/bluemonday"
+)
+
+// OAI-DC namespaces
+const dcNamespace = "http://purl.org/dc/elements/1.1/"
+const dcOAINamespace = "http://www.openarchives.org/OAI/2.0/oai_dc/"
+const dcSchemaLocation = "http://www.openarchives.org/OAI/2.0/oai_dc/ http://www.openarchives.org/OAI/2.0/oai_dc.xsd"
+
+// DCMI types
+const dcTypeImage = "Image"
+const dcTypeMovingImage = "MovingImage"
+const dcTypeSound = "Sound"
+const dcTypeStillImage = "StillImage"
+const dcTypeText = "Text"
+
+// simple Dublin Core record; every element is optional and repeatable
+type dcRecord struct {
+	XMLName        xml.Name `xml:"oai_dc:dc" json:"-"`
+	OAINamespace   string   `xml:"xmlns:oai_dc,attr" json:"-"`
+	DCNamespace    string   `xml:"xmlns:dc,attr" json:"-"`
+	XSINamespace   string   `xml:"xmlns:xsi,attr" json:"-"`
+	SchemaLocation string   `xml:"xsi:schemaLocation,attr" json:"-"`
+	Title          []string `xml:"dc:title" json:"title,omitempty"`
+	Creator        []string `xml:"dc:creator" json:"creator,omitempty"`
+	Contributor    []string `xml:"dc:contributor" json:"contributor,omitempty"`
+	Subject        []string `xml:"dc:subject" json:"subject,omitempty"`
+	Description    []string `xml:"dc:description" json:"description,omitempty"`
+	Publisher      []string `xml:"dc:publisher" json:"publisher,omitempty"`
+	Date           []string `xml:"dc:date" json:"date,omitempty"`
+	Type           []string `xml:"dc:type" json:"type,omitempty"`
+	Identifier     []string `xml:"dc:identifier" json:"identifier,omitempty"`
+	Language       []string `xml:"dc:language" json:"language,omitempty"`
+	Rights         []string `xml:"dc:rights" json:"rights,omitempty"`
+}
+
+type dcEncoder struct {
+	cfg    serviceConfigFormat
+	url    string
+	asJSON bool
+	record dcRecord
+	policy *bluemonday.Policy
+}
+
+var dcTypesMap map[string]string
+
+func newDcEncoder(cfg serviceConfigFormat, asJSON bool) *dcEncoder {
+	e := dcEncoder{}
+
+	e.cfg = cfg
+	e.asJSON = asJSON
+	e.policy = bluemonday.StrictPolicy()
+
+	return &e
+}
+
+func (e *dcEncoder) Init(c *clientContext, url string) {
+	e.url = url
+}
+
+func (e *dcEncoder) Populate(parts citationParts) error {
+	data, err := newRawCitation(e.url, parts)
+	if err != nil {
+		return err
+	}
+
+	rec := dcRecord{}
+
+	rec.Title = e.cleanStrings([]string{data.title})
+	rec.Creator = e.cleanStrings(data.authors)
+
+	for _, contributors := range [][]string{data.editors, data.advisors, data.translators, data.compilers} {
+		rec.Contributor = append(rec.Contributor, e.cleanStrings(contributors)...)
+	}
+
+	rec.Subject = e.cleanStrings(parts["subject"])
+	rec.Description = append(e.cleanStrings(parts["abstract"]), e.cleanStrings(parts["description"])...)
+	rec.Publisher = e.cleanStrings([]string{data.publisher})
+
+	if data.year != 0 {
+		rec.Date = []string{isoDate(data.year, data.month, data.day)}
+	}
+
+	if dcType, ok := dcTypesMap[data.format]; ok == true {
+		rec.Type = []string{dcType}
+	}
+
+	if doi := re.doiPrefix.ReplaceAllString(e.cleanString(firstElementOf(parts["doi"])), ""); doi != "" {
+		rec.Identifier = append(rec.Identifier, "https://doi.org/"+doi)
+	}
+
+	rec.Identifier = append(rec.Identifier, e.cleanStrings(parts["url"])...)
+
+	if e.url != "" && sliceContainsString(rec.Identifier, e.url) == false {
+		rec.Identifier = append(rec.Identifier, e.url)
+	}
+
+	serialPrefix := "urn:" + serialNumberKind(data.format) + ":"
+
+	for _, serialNumber := range e.cleanStrings(parts["serial_number"]) {
+		rec.Identifier = append(rec.Identifier, serialPrefix+serialNumber)
+	}
+
+	rec.Language = e.cleanStrings(parts["language"])
+	rec.Rights = e.cleanStrings(parts["rights"])
+
+	e.record = rec
+
+	return nil
+}
+
+func (e *dcEncoder) cleanString(val string) string {
+	return plainText(e.policy, val)
+}
+
+func (e *dcEncoder) cleanStrings(vals []string) []string {
+	var cleaned []string
+
+	for _, val := range vals {
+		if c := e.cleanString(val); c != "" {
+			cleaned = append(cleaned, c)
+		}
+	}
+
+	return cleaned
+}
+
+func (e *dcEncoder) Label() string {
+	return e.cfg.Label
+}
+
+func (e *dcEncoder) ContentType() string {
+	return e.cfg.ContentType
+}
+
+func (e *dcEncoder) FileName() string {
+	filename := itemName(e.url)
+
+	if e.cfg.Extension != "" {
+		filename += "." + e.cfg.Extension
+	}
+
+	return filename
+}
+
+func (e *dcEncoder) Contents() (string, error) {
+	if e.asJSON == true {
+		var b bytes.Buffer
+
+		enc := json.NewEncoder(&b)
+		enc.SetEscapeHTML(false)
+		enc.SetIndent("", "  ")
+
+		if err := enc.Encode(e.record); err != nil {
+			return "", err
+		}
+
+		return b.String(), nil
+	}
+
+	rec := e.record
+
+	rec.OAINamespace = dcOAINamespace
+	rec.DCNamespace = dcNamespace
+	rec.XSINamespace = "http://www.w3.org/2001/XMLSchema-instance"
+	rec.SchemaLocation = dcSchemaLocation
+
+	data, err := xml.MarshalIndent(rec, "", "  ")
+	if err != nil {
+		return "", err
+	}
+
+	return xml.Header + string(data) + "\n", nil
+}
+
+func dcOutputIsJSON(as string) (bool, bool) {
+	// returns whether json output was requested, and whether the request was valid
+	switch strings.ToLower(as) {
+	case "", "xml":
+		return false, true
+	case "json":
+		return true, true
+	}
+
+	return false, false
+}
+
+func init() {
+	// mapping of citation formats (citation part "format") to DCMI type
+	dcTypesMap = make(map[string]string)
+
+	dcTypesMap["art"] = dcTypeStillImage
+	dcTypesMap["article"] = dcTypeText
+	dcTypesMap["book"] = dcTypeText
+	dcTypesMap["government_document"] = dcTypeText
+	dcTypesMap["journal"] = dcTypeText
+	dcTypesMap["manuscript"] = dcTypeText
+	dcTypesMap["map"] = dcTypeImage
+	dcTypesMap["music"] = dcTypeText
+	dcTypesMap["news"] = dcTypeText
+	dcTypesMap["sound"] = dcTypeSound
+	dcTypesMap["thesis"] = dcTypeText
+	dcTypesMap["video"] = dcTypeMovingImage
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+
+	"github.com/microcosm-cc/bluemonday"
+)
+
+// EndNote reference types
+type endnoteRefType struct {
+	Name   string `xml:"name,attr"`
+	Number int    `xml:",chardata"`
+}
+
+var endnoteTypeArtwork = endnoteRefType{Name: "Artwork", Number: 2}
+var endnoteTypeAudiovisual = endnoteRefType{Name: "Audiovisual Material", Number: 3}
+var endnoteTypeBook = endnoteRefType{Name: "Book", Number: 6}
+var endnoteTypeFilm = endnoteRefType{Name: "Film or Broadcast", Number: 21}
+var endnoteTypeGeneric = endnoteRefType{Name: "Generic", Number: 13}
+var endnoteTypeGovernmentDocument = endnoteRefType{Name: "Government Document", Number: 46}
+var endnoteTypeJournalArticle = endnoteRefType{Name: "Journal Article", Number: 17}
+var endnoteTypeManuscript = endnoteRefType{Name: "Manuscript", Number: 36}
+var endnoteTypeMap = endnoteRefType{Name: "Map", Number: 20}
+var endnoteTypeMusic = endnoteRefType{Name: "Music", Number: 61}
+var endnoteTypeNewspaperArticle = endnoteRefType{Name: "Newspaper Article", Number: 23}
+var endnoteTypeThesis = endnoteRefType{Name: "Thesis", Number: 32}
+
+type endnoteSourceApp struct {
+	Name    string `xml:"name,attr"`
+	Version string `xml:"version,attr"`
+	Value   string `xml:",chardata"`
+}
+
+// encoding/xml emits the parent of an empty "a>b" list, so lists that
+// may be empty are wrapped in their own (omitted when nil) elements
+type endnoteAuthors struct {
+	Authors []string `xml:"author"`
+}
+
+type endnoteKeywords struct {
+	Keywords []string `xml:"keyword"`
+}
+
+type endnoteURLList struct {
+	URLs []string `xml:"url"`
+}
+
+type endnoteContributors struct {
+	Authors           *endnoteAuthors `xml:"authors,omitempty"`
+	SecondaryAuthors  *endnoteAuthors `xml:"secondary-authors,omitempty"`
+	TertiaryAuthors   *endnoteAuthors `xml:"tertiary-authors,omitempty"`
+	SubsidiaryAuthors *endnoteAuthors `xml:"subsidiary-authors,omitempty"`
+}
+
+type endnoteTitles struct {
+	Title          string `xml:"title,omitempty"`
+	SecondaryTitle string `xml:"secondary-title,omitempty"`
+	TertiaryTitle  string `xml:"tertiary-title,omitempty"`
+}
+
+type endnotePeriodical struct {
+	FullTitle string `xml:"full-title,omitempty"`
+}
+
+type endnoteDates struct {
+	Year     string   `xml:"year,omitempty"`
+	PubDates []string `xml:"pub-dates>date,omitempty"`
+}
+
+type endnoteURLs struct {
+	RelatedURLs *endnoteURLList `xml:"related-urls,omitempty"`
+	TextURLs    *endnoteURLList `xml:"text-urls,omitempty"`
+}
+
+// elements are in the order defined by the EndNote XML DTD
+type endnoteRecord struct {
+	SourceApp             endnoteSourceApp     `xml:"source-app"`
+	RecNumber             int                  `xml:"rec-number"`
+	RefType               endnoteRefType       `xml:"ref-type"`
+	Contributors          *endnoteContributors `xml:"contributors,omitempty"`
+	Titles                *endnoteTitles       `xml:"titles,omitempty"`
+	Periodical            *endnotePeriodical   `xml:"periodical,omitempty"`
+	Pages                 string               `xml:"pages,omitempty"`
+	Volume                string               `xml:"volume,omitempty"`
+	Number                string               `xml:"number,omitempty"`
+	Edition               string               `xml:"edition,omitempty"`
+	Keywords              *endnoteKeywords     `xml:"keywords,omitempty"`
+	Dates                 *endnoteDates        `xml:"dates,omitempty"`
+	PubLocation           string               `xml:"pub-location,omitempty"`
+	Publisher             string               `xml:"publisher,omitempty"`
+	ISBN                  string               `xml:"isbn,omitempty"`
+	AccessionNum          string               `xml:"accession-num,omitempty"`
+	CallNum               string               `xml:"call-num,omitempty"`
+	ElectronicResourceNum string               `xml:"electronic-resource-num,omitempty"`
+	Abstract              string               `xml:"abstract,omitempty"`
+	Notes                 string               `xml:"notes,omitempty"`
+	WorkType              string               `xml:"work-type,omitempty"`
+	RemoteDatabaseName    string               `xml:"remote-database-name,omitempty"`
+	RemoteDatabaseProv    string               `xml:"remote-database-provider,omitempty"`
+	Language              string               `xml:"language,omitempty"`
+	URLs                  *endnoteURLs         `xml:"urls,omitempty"`
+}
+
+type endnoteXML struct {
+	XMLName xml.Name        `xml:"xml"`
+	Records []endnoteRecord `xml:"records>record"`
+}
+
+type endnoteXmlEncoder struct {
+	cfg    serviceConfigFormat
+	url    string
+	record endnoteRecord
+	policy *bluemonday.Policy
+}
+
+var endnoteTypesMap map[string]endnoteRefType
+
+func newEndnoteXmlEncoder(cfg serviceConfigFormat) *endnoteXmlEncoder {
+	e := endnoteXmlEncoder{}
+
+	e.cfg = cfg
+	e.policy = bluemonday.StrictPolicy()
+
+	return &e
+}
+
+func (e *endnoteXmlEncoder) Init(c *clientContext, url string) {
+	e.url = url
+}
+
+func (e *endnoteXmlEncoder) Populate(parts citationParts) error {
+	data, err := newRawCitation(e.url, parts)
+	if err != nil {
+		return err
+	}
+
+	rec := endnoteRecord{}
+
+	rec.SourceApp = endnoteSourceApp{Name: "Virgo", Version: "4", Value: "Virgo"}
+	rec.RecNumber = 1
+
+	rec.RefType = endnoteTypeGeneric
+	if refType, ok := endnoteTypesMap[data.format]; ok == true {
+		rec.RefType = refType
+	} else {
+		metrics.fallbackFormat("endnote")
+	}
+
+	// contributor roles, as EndNote labels them for most reference types:
+	// secondary = editor, tertiary = advisor (for theses), subsidiary = translator
+	contributors := endnoteContributors{
+		Authors:           e.authorList(data.authors),
+		SecondaryAuthors:  e.authorList(data.editors),
+		TertiaryAuthors:   e.authorList(data.advisors),
+		SubsidiaryAuthors: e.authorList(data.translators),
+	}
+
+	if contributors != (endnoteContributors{}) {
+		rec.Contributors = &contributors
+	}
+
+	titles := endnoteTitles{
+		Title:          e.cleanString(data.title),
+		SecondaryTitle: e.cleanString(data.journal),
+		TertiaryTitle:  e.cleanString(firstElementOf(parts["series"])),
+	}
+
+	if titles != (endnoteTitles{}) {
+		rec.Titles = &titles
+	}
+
+	if data.journal != "" {
+		rec.Periodical = &endnotePeriodical{FullTitle: e.cleanString(data.journal)}
+	}
+
+	rec.Pages = data.pageFrom
+	if data.pageTo != "" {
+		rec.Pages += "-" + data.pageTo
+	}
+
+	rec.Volume = e.cleanString(data.volume)
+	rec.Number = e.cleanString(data.issue)
+	rec.Edition = e.cleanString(cleanEndPunctuation(firstElementOf(parts["edition"])))
+
+	if keywords := e.cleanStrings(parts["subject"]); len(keywords) > 0 {
+		rec.Keywords = &endnoteKeywords{Keywords: keywords}
+	}
+
+	if data.year != 0 {
+		rec.Dates = &endnoteDates{
+			Year:     fmt.Sprintf("%d", data.year),
+			PubDates: []string{isoDate(data.year, data.month, data.day)},
+		}
+	}
+
+	rec.PubLocation = e.cleanString(cleanEndPunctuation(firstElementOf(parts["published_location"])))
+	rec.Publisher = e.cleanString(data.publisher)
+
+	// EndNote stores both ISBNs and ISSNs here
+	rec.ISBN = e.cleanString(strings.Join(parts["serial_number"], "; "))
+
+	rec.AccessionNum = e.cleanString(firstElementOf(parts["location"]))
+	rec.CallNum = e.cleanString(strings.Join(parts["call_number"], "; "))
+	rec.ElectronicResourceNum = re.doiPrefix.ReplaceAllString(e.cleanString(firstElementOf(parts["doi"])), "")
+	rec.Abstract = e.cleanString(strings.Join(parts["abstract"], " "))
+	rec.Notes = e.cleanString(strings.Join(parts["description"], "\n"))
+	rec.WorkType = e.cleanString(firstElementOf(parts["genre"]))
+	rec.RemoteDatabaseName = e.cleanString(firstElementOf(parts["content_provider"]))
+	rec.RemoteDatabaseProv = e.cleanString(firstElementOf(parts["library"]))
+	rec.Language = e.cleanString(firstElementOf(parts["language"]))
+
+	relatedURLs := e.cleanStrings(parts["url"])
+	if e.url != "" {
+		relatedURLs = append(relatedURLs, e.url)
+	}
+
+	urls := endnoteURLs{
+		RelatedURLs: e.urlList(relatedURLs),
+		TextURLs:    e.urlList(e.cleanStrings(parts["full_text_url"])),
+	}
+
+	if urls != (endnoteURLs{}) {
+		rec.URLs = &urls
+	}
+
+	e.record = rec
+
+	return nil
+}
+
+func (e *endnoteXmlEncoder) cleanString(val string) string {
+	return plainText(e.policy, val)
+}
+
+func (e *endnoteXmlEncoder) cleanStrings(vals []string) []string {
+	var cleaned []string
+
+	for _, val := range vals {
+		if c := e.cleanString(val); c != "" {
+			cleaned = append(cleaned, c)
+		}
+	}
+
+	return cleaned
+}
+
+func (e *endnoteXmlEncoder) authorList(names []string) *endnoteAuthors {
+	if cleaned := e.cleanStrings(names); len(cleaned) > 0 {
+		return &endnoteAuthors{Authors: cleaned}
+	}
+
+	return nil
+}
+
+func (e *endnoteXmlEncoder) urlList(urls []string) *endnoteURLList {
+	if len(urls) > 0 {
+		return &endnoteURLList{URLs: urls}
+	}
+
+	return nil
+}
+
+func (e *endnoteXmlEncoder) Label() string {
+	return e.cfg.Label
+}
+
+func (e *endnoteXmlEncoder) ContentType() string {
+	return e.cfg.ContentType
+}
+
+func (e *endnoteXmlEncoder) FileName() string {
+	filename := itemName(e.url)
+
+	if e.cfg.Extension != "" {
+		filename += "." + e.cfg.Extension
+	}
+
+	return filename
+}
+
+func (e *endnoteXmlEncoder) Contents() (string, error) {
+	doc := endnoteXML{Records: []endnoteRecord{e.record}}
+
+	data, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return "", err
+	}
+
+	return xml.Header + string(data) + "\n", nil
+}
+
+func init() {
+	// mapping of citation formats (citation part "format") to EndNote reference type
+	endnoteTypesMap = make(map[string]endnoteRefType)
+
+	endnoteTypesMap["art"] = endnoteTypeArtwork
+	endnoteTypesMap["article"] = endnoteTypeJournalArticle
+	endnoteTypesMap["book"] = endnoteTypeBook
+	endnoteTypesMap["generic"] = endnoteTypeGeneric
+	endnoteTypesMap["government_document"] = endnoteTypeGovernmentDocument
+	endnoteTypesMap["journal"] = endnoteTypeJournalArticle
+	endnoteTypesMap["manuscript"] = endnoteTypeManuscript
+	endnoteTypesMap["map"] = endnoteTypeMap
+	endnoteTypesMap["music"] = endnoteTypeMusic
+	endnoteTypesMap["news"] = endnoteTypeNewspaperArticle
+	endnoteTypesMap["sound"] = endnoteTypeAudiovisual
+	endnoteTypesMap["thesis"] = endnoteTypeThesis
+	endnoteTypesMap["video"] = endnoteTypeFilm
+}
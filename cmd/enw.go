@@ -0,0 +1,312 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/microcosm-cc/bluemonday"
+)
+
+// subset of EndNote tagged (Refer/BibIX) tags needed in code below
+const enwTagAbstract = "%X"
+const enwTagAccessionNumber = "%M"
+const enwTagAuthor = "%A"
+const enwTagAuthorSubsidiary = "%?"
+const enwTagAuthorTertiary = "%Y"
+const enwTagCallNumber = "%L"
+const enwTagDOI = "%R"
+const enwTagDatabase = "%~"
+const enwTagDate = "%D"
+const enwTagEdition = "%7"
+const enwTagEditor = "%E"
+const enwTagFullTextLink = "%>"
+const enwTagIssueNumber = "%N"
+const enwTagJournalTitle = "%J"
+const enwTagKeyword = "%K"
+const enwTagLanguage = "%G"
+const enwTagLibrary = "%W"
+const enwTagNote = "%Z"
+const enwTagPages = "%P"
+const enwTagPlacePublished = "%C"
+const enwTagPublisher = "%I"
+const enwTagSecondaryTitle = "%B"
+const enwTagSerialNumber = "%@"
+const enwTagSubtitle = "X1" // not an actual tag; only used for constructing full titles
+const enwTagTitle = "%T"
+const enwTagType = "%0"
+const enwTagTypeOfWork = "%9"
+const enwTagURL = "%U"
+const enwTagVolumeNumber = "%V"
+
+// misc definitions
+const enwLineEnding = "\n"
+const enwLineFormat = "%s %s" + enwLineEnding
+
+type enwEncoder struct {
+	cfg       serviceConfigFormat
+	url       string
+	tagValues tagValueMap
+	policy    *bluemonday.Policy
+}
+
+var enwPartsMap map[string][]string
+var enwPartsOrderedKeys []string
+
+func newEnwEncoder(cfg serviceConfigFormat) *enwEncoder {
+	e := enwEncoder{}
+
+	e.cfg = cfg
+	e.tagValues = make(tagValueMap)
+	e.policy = bluemonday.UGCPolicy()
+
+	return &e
+}
+
+func (e *enwEncoder) Init(c *clientContext, url string) {
+	e.url = url
+}
+
+func (e *enwEncoder) Populate(parts citationParts) error {
+	for _, part := range enwPartsOrderedKeys {
+		for _, enwTag := range enwPartsMap[part] {
+			for _, value := range parts[part] {
+				enwValue := value
+
+				// EndNote reference type names are shared with the EndNote XML format
+				if enwTag == enwTagType {
+					enwValue = endnoteTypeGeneric.Name
+					if refType, ok := endnoteTypesMap[value]; ok == true {
+						enwValue = refType.Name
+					} else {
+						metrics.fallbackFormat("enw")
+					}
+				}
+
+				e.addTagValue(enwTag, enwValue)
+			}
+		}
+	}
+
+	if len(e.tagValues[enwTagType]) == 0 {
+		e.addTagValue(enwTagType, endnoteTypeGeneric.Name)
+		metrics.fallbackFormat("enw")
+	}
+
+	// dates and page ranges are normalized the same way as in the other formats
+	opts := genericCitationOpts{}
+
+	data, err := newGenericCitation(e.url, parts, opts)
+	if err != nil {
+		return err
+	}
+
+	delete(e.tagValues, enwTagDate)
+	if data.year != 0 {
+		e.addTagValue(enwTagDate, fmt.Sprintf("%d", data.year))
+	}
+
+	delete(e.tagValues, enwTagPages)
+	if data.pageFrom != "" {
+		pages := data.pageFrom
+		if data.pageTo != "" {
+			pages += "-" + data.pageTo
+		}
+
+		e.addTagValue(enwTagPages, pages)
+	}
+
+	// DOIs are expected without any prefix
+	for i, doi := range e.tagValues[enwTagDOI] {
+		e.tagValues[enwTagDOI][i] = re.doiPrefix.ReplaceAllString(doi, "")
+	}
+
+	// places are often followed by catalog punctuation
+	for i, place := range e.tagValues[enwTagPlacePublished] {
+		e.tagValues[enwTagPlacePublished][i] = cleanEndPunctuation(place)
+	}
+
+	// if present, move subtitle to the end of the title
+
+	if len(e.tagValues[enwTagSubtitle]) > 0 {
+		title := firstElementOf(e.tagValues[enwTagTitle])
+		subtitle := firstElementOf(e.tagValues[enwTagSubtitle])
+
+		fullTitle := title
+		if subtitle != "" {
+			fullTitle = fullTitle + ": " + subtitle
+		}
+
+		fullTitle = removeTrailingPeriods(fullTitle)
+
+		e.tagValues[enwTagTitle] = []string{fullTitle}
+		delete(e.tagValues, enwTagSubtitle)
+	}
+
+	return nil
+}
+
+func (e *enwEncoder) addTagValue(enwTag, value string) {
+	e.tagValues[enwTag] = append(e.tagValues[enwTag], value)
+}
+
+func (e *enwEncoder) Label() string {
+	return e.cfg.Label
+}
+
+func (e *enwEncoder) ContentType() string {
+	return e.cfg.ContentType
+}
+
+func (e *enwEncoder) FileName() string {
+	filename := itemName(e.url)
+
+	if e.cfg.Extension != "" {
+		filename += "." + e.cfg.Extension
+	}
+
+	return filename
+}
+
+func (e *enwEncoder) isRepeatableTag(tag string) bool {
+	switch tag {
+	case enwTagAuthor:
+	case enwTagAuthorSubsidiary:
+	case enwTagAuthorTertiary:
+	case enwTagEditor:
+	case enwTagKeyword:
+	case enwTagNote:
+	case enwTagURL:
+
+	default:
+		return false
+	}
+
+	return true
+}
+
+func (e *enwEncoder) getTagValue(val string) string {
+	value := strings.ReplaceAll(val, `\n`, "\n")
+
+	// continuation lines are not reliably supported by importers, so
+	// each line of data is cleaned and joined into a single line
+	var lines []string
+	for _, line := range strings.Split(value, "\n") {
+		if cleaned := cleanTaggedString(e.policy, line); cleaned != "" {
+			lines = append(lines, cleaned)
+		}
+	}
+
+	return strings.Join(lines, " ")
+}
+
+func (e *enwEncoder) Contents() (string, error) {
+	if e.url != "" {
+		e.addTagValue(enwTagURL, e.url)
+	}
+
+	tags := []string{}
+	for tag := range e.tagValues {
+		// prevent specific tags from appearing in the record body
+		if tag == enwTagType || tag == enwTagSubtitle {
+			continue
+		}
+
+		tags = append(tags, tag)
+	}
+
+	sort.Strings(tags)
+
+	var b strings.Builder
+
+	// use first type as type
+	fmt.Fprintf(&b, enwLineFormat, enwTagType, e.tagValues[enwTagType][0])
+
+	for _, tag := range tags {
+		values := e.tagValues[tag]
+
+		if e.isRepeatableTag(tag) == false {
+			values = []string{strings.Join(values, ", ")}
+		}
+
+		for _, val := range values {
+			if cleaned := e.getTagValue(val); cleaned != "" {
+				fmt.Fprintf(&b, enwLineFormat, tag, cleaned)
+			}
+		}
+	}
+
+	// records are separated by a blank line
+	b.WriteString(enwLineEnding)
+
+	return b.String(), nil
+}
+
+func init() {
+	// mapping of citation parts to EndNote tag(s)
+	enwPartsMap = make(map[string][]string)
+
+	enwPartsMap["abstract"] = []string{enwTagAbstract}
+	enwPartsMap["advisor"] = []string{enwTagAuthorTertiary}
+	enwPartsMap["author"] = []string{enwTagAuthor}
+	enwPartsMap["call_number"] = []string{enwTagCallNumber}
+	enwPartsMap["content_provider"] = []string{enwTagDatabase}
+	enwPartsMap["description"] = []string{enwTagNote}
+	enwPartsMap["doi"] = []string{enwTagDOI}
+	enwPartsMap["edition"] = []string{enwTagEdition}
+	enwPartsMap["editor"] = []string{enwTagEditor}
+	enwPartsMap["format"] = []string{enwTagType}
+	enwPartsMap["full_text_url"] = []string{enwTagFullTextLink}
+	enwPartsMap["genre"] = []string{enwTagTypeOfWork}
+	enwPartsMap["issue"] = []string{enwTagIssueNumber}
+	enwPartsMap["journal"] = []string{enwTagJournalTitle}
+	enwPartsMap["language"] = []string{enwTagLanguage}
+	enwPartsMap["library"] = []string{enwTagLibrary}
+	enwPartsMap["location"] = []string{enwTagAccessionNumber}
+	enwPartsMap["pages"] = []string{enwTagPages}
+	enwPartsMap["published_location"] = []string{enwTagPlacePublished}
+	enwPartsMap["published_date"] = []string{enwTagDate}
+	enwPartsMap["publisher"] = []string{enwTagPublisher}
+	enwPartsMap["serial_number"] = []string{enwTagSerialNumber}
+	enwPartsMap["series"] = []string{enwTagSecondaryTitle}
+	enwPartsMap["subject"] = []string{enwTagKeyword}
+	enwPartsMap["subtitle"] = []string{enwTagSubtitle}
+	enwPartsMap["title"] = []string{enwTagTitle}
+	enwPartsMap["translator"] = []string{enwTagAuthorSubsidiary}
+	enwPartsMap["url"] = []string{enwTagURL}
+	enwPartsMap["volume"] = []string{enwTagVolumeNumber}
+
+	// define specific order for traversing the parts map, to ensure preferred
+	// (or at least stable) values for citation parts that map to the same tag
+	enwPartsOrderedKeys = []string{
+		"abstract",
+		"advisor",
+		"author",
+		"call_number",
+		"content_provider",
+		"description",
+		"doi",
+		"edition",
+		"editor",
+		"format",
+		"full_text_url",
+		"genre",
+		"issue",
+		"journal",
+		"language",
+		"library",
+		"location",
+		"pages",
+		"published_location",
+		"published_date",
+		"publisher",
+		"serial_number",
+		"series",
+		"subject",
+		"subtitle",
+		"title",
+		"translator",
+		"url",
+		"volume",
+	}
+}
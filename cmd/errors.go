@@ -0,0 +1,145 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// kinds of errors reported to clients, so that they can react to e.g. items that
+// are no longer available differently than to a pool that is temporarily down
+const (
+	errorBadRequest          = "bad_request"
+	errorUnauthorized        = "unauthorized"
+	errorNotFound            = "not_found"
+	errorGone                = "gone"
+	errorNotAcceptable       = "not_acceptable"
+	errorTooLarge            = "too_large"
+	errorUpstreamTimeout     = "upstream_timeout"
+	errorUpstreamUnavailable = "upstream_unavailable"
+	errorBadRecord           = "bad_record"
+	errorInternal            = "internal"
+)
+
+var errItemUnavailable = errors.New("item is no longer available")
+var errItemUnauthorized = errors.New("item is not available to this user")
+var errPoolTimeout = errors.New("pool did not respond in time")
+var errPoolUnavailable = errors.New("pool is currently unavailable")
+var errNoExplicitCitation = errors.New("no explicit citation for this item")
+
+// the error envelope for json-producing endpoints
+type errorResp struct {
+	Code      string            `json:"code"`
+	Message   string            `json:"message"`
+	RequestID string            `json:"request_id"`
+	Failures  []citationFailure `json:"failures,omitempty"`
+}
+
+// why a particular style could not be generated
+type citationFailure struct {
+	Style   string `json:"style"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (r serviceResponse) errorCode() string {
+	if r.code != "" {
+		return r.code
+	}
+
+	switch r.status {
+	case http.StatusBadRequest:
+		return errorBadRequest
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return errorUnauthorized
+	case http.StatusNotFound:
+		return errorNotFound
+	case http.StatusGone:
+		return errorGone
+	case http.StatusNotAcceptable:
+		return errorNotAcceptable
+	case http.StatusRequestEntityTooLarge:
+		return errorTooLarge
+	case http.StatusGatewayTimeout:
+		return errorUpstreamTimeout
+	case http.StatusBadGateway, http.StatusServiceUnavailable:
+		return errorUpstreamUnavailable
+	}
+
+	return errorInternal
+}
+
+// maps a failed pool response to the status reported to the client
+func (s *citationsContext) poolErrorResponse(poolStatus int) serviceResponse {
+	switch poolStatus {
+	// 404 errors from the pool are likely old bookmarked items that have since become shadowed, or no longer exist
+	case http.StatusNotFound:
+		return serviceResponse{status: http.StatusNotFound, err: errItemUnavailable}
+
+	case http.StatusGone:
+		return serviceResponse{status: http.StatusGone, err: errItemUnavailable}
+
+	// the pool will not show this item to this caller; anonymous callers may be able to sign in
+	case http.StatusUnauthorized, http.StatusForbidden:
+		status := http.StatusForbidden
+		if s.client.claims == nil {
+			status = http.StatusUnauthorized
+		}
+
+		return serviceResponse{status: status, err: errItemUnauthorized}
+
+	case http.StatusGatewayTimeout:
+		return serviceResponse{status: http.StatusGatewayTimeout, err: errPoolTimeout}
+	}
+
+	return serviceResponse{status: http.StatusBadGateway, err: errPoolUnavailable}
+}
+
+// maps a failure to generate a citation from an otherwise usable record
+func contentsErrorResponse(err error) serviceResponse {
+	if err == errNoExplicitCitation {
+		return serviceResponse{status: http.StatusNotFound, err: err}
+	}
+
+	return serviceResponse{status: http.StatusInternalServerError, err: err}
+}
+
+func jsonErrorsForRoute(ctx *gin.Context) bool {
+	// batch requests, and styles served as json label/value pairs, report errors as json.
+	// file downloads (and unAPI) report errors as plain text, as they always have.
+	route := ctx.FullPath()
+
+	if strings.HasSuffix(route, "/batch") == true {
+		return true
+	}
+
+	name := ctx.Param("style")
+	if name == "" {
+		name = path.Base(route)
+	}
+
+	if name == "all" {
+		return true
+	}
+
+	style, ok := citationStyles[name]
+
+	return ok == true && style.json == true
+}
+
+func (c *clientContext) serveError(resp serviceResponse, failures ...citationFailure) {
+	if c.jsonErrors == false {
+		c.ginCtx.String(resp.status, resp.err.Error())
+		return
+	}
+
+	c.ginCtx.JSON(resp.status, errorResp{
+		Code:      resp.errorCode(),
+		Message:   resp.err.Error(),
+		RequestID: c.reqID,
+		Failures:  failures,
+	})
+}
@@ -160,6 +160,27 @@ func newGenericCitation(v4url string, parts citationParts, opts genericCitationO
 	return &c, nil
 }
 
+// raw values, for export formats: no prefixes or publisher places
+func newRawCitation(v4url string, parts citationParts) (*genericCitation, error) {
+	return newGenericCitation(v4url, parts, genericCitationOpts{})
+}
+
+// kinds of serial numbers
+const (
+	serialNumberISSN = "issn"
+	serialNumberISBN = "isbn"
+)
+
+// serial numbers are ISSNs for articles, otherwise (most likely) ISBNs
+func serialNumberKind(format string) string {
+	switch format {
+	case "article", "journal", "news":
+		return serialNumberISSN
+	}
+
+	return serialNumberISBN
+}
+
 func (c *genericCitation) log(parts citationParts) {
 	if c.opts.verbose == false {
 		return
@@ -659,90 +680,158 @@ func readingOrder(name string) string {
 	case len(commaParts) == 1:
 		nameParts := wordsBySeparator(commaParts[0], " ")
 
-		/*
-		   # Remove the elements from the end of *name_parts* which appear to be a
-		   # last name, accounting for multi-part names like "de la Croix" or
-		   # "v. Ribbentrop".
-		   #
-		   # @param [Array<String>] name_parts   Array to be modified.
-		   #
-		   # @return [String]
-		   #
-		   # === Implementation Notes
-		   # It is assumed that the full name represented by *name_parts* is comprised
-		   # of zero or more "given" names and a surname which may begin with zero or
-		   # more lowercase words (like "de" or "la") followed by one or more surnames
-		   # (or ordinal designations like "VIII") which each begin with a capital
-		   # (although the surnames themselves may contain spaces).
-		   #
-		   def extract_last_name!(name_parts)
-		     surname   = name_parts.pop
-		     lowercase = /^\p{Lower}+([\s.-]\p{Lower})*$/u
-		     if name_parts.any? { |part| part =~ lowercase }
-		       result = [surname]
-		       result.unshift(name_parts.pop) while name_parts.last !~ lowercase
-		       result.unshift(name_parts.pop) while name_parts.last =~ lowercase
-		       result.join(' ')
-		     else
-		       surname
-		     end
-		   end
-		*/
-
-		lastName, nameParts = nameParts[len(nameParts)-1], nameParts[:len(nameParts)-1]
-
-		hasLowerLast := false
-		for _, part := range nameParts {
-			if re.lowerLastNamePart.MatchString(part) == true {
-				hasLowerLast = true
-				break
-			}
-		}
+		lastName, nameParts = extractLastName(nameParts)
 
-		if hasLowerLast == true {
-			lastParts := []string{lastName}
+		otherNames = strings.Join(nameParts, " ")
+	}
 
-			for {
-				if len(nameParts) == 0 {
-					break
-				}
+	if otherNames != "" {
+		otherNames += " "
+	}
 
-				lastPart := nameParts[len(nameParts)-1]
+	return fmt.Sprintf("%s%s%s", otherNames, lastName, suffixes)
+}
 
-				if re.lowerLastNamePart.MatchString(lastPart) == true {
-					break
-				}
+func extractLastName(nameParts []string) (string, []string) {
+	/*
+	   # Remove the elements from the end of *name_parts* which appear to be a
+	   # last name, accounting for multi-part names like "de la Croix" or
+	   # "v. Ribbentrop".
+	   #
+	   # @param [Array<String>] name_parts   Array to be modified.
+	   #
+	   # @return [String]
+	   #
+	   # === Implementation Notes
+	   # It is assumed that the full name represented by *name_parts* is comprised
+	   # of zero or more "given" names and a surname which may begin with zero or
+	   # more lowercase words (like "de" or "la") followed by one or more surnames
+	   # (or ordinal designations like "VIII") which each begin with a capital
+	   # (although the surnames themselves may contain spaces).
+	   #
+	   def extract_last_name!(name_parts)
+	     surname   = name_parts.pop
+	     lowercase = /^\p{Lower}+([\s.-]\p{Lower})*$/u
+	     if name_parts.any? { |part| part =~ lowercase }
+	       result = [surname]
+	       result.unshift(name_parts.pop) while name_parts.last !~ lowercase
+	       result.unshift(name_parts.pop) while name_parts.last =~ lowercase
+	       result.join(' ')
+	     else
+	       surname
+	     end
+	   end
+	*/
+
+	if len(nameParts) == 0 {
+		return "", nameParts
+	}
+
+	lastName, nameParts := nameParts[len(nameParts)-1], nameParts[:len(nameParts)-1]
+
+	hasLowerLast := false
+	for _, part := range nameParts {
+		if re.lowerLastNamePart.MatchString(part) == true {
+			hasLowerLast = true
+			break
+		}
+	}
 
-				lastParts = append([]string{lastPart}, lastParts...)
-				nameParts = nameParts[:len(nameParts)-1]
+	if hasLowerLast == true {
+		lastParts := []string{lastName}
+
+		for {
+			if len(nameParts) == 0 {
+				break
 			}
 
-			for {
-				if len(nameParts) == 0 {
-					break
-				}
+			lastPart := nameParts[len(nameParts)-1]
 
-				lastPart := nameParts[len(nameParts)-1]
+			if re.lowerLastNamePart.MatchString(lastPart) == true {
+				break
+			}
 
-				if re.lowerLastNamePart.MatchString(lastPart) == false {
-					break
-				}
+			lastParts = append([]string{lastPart}, lastParts...)
+			nameParts = nameParts[:len(nameParts)-1]
+		}
 
-				lastParts = append([]string{lastPart}, lastParts...)
-				nameParts = nameParts[:len(nameParts)-1]
+		for {
+			if len(nameParts) == 0 {
+				break
 			}
 
-			lastName = strings.Join(lastParts, " ")
+			lastPart := nameParts[len(nameParts)-1]
+
+			if re.lowerLastNamePart.MatchString(lastPart) == false {
+				break
+			}
+
+			lastParts = append([]string{lastPart}, lastParts...)
+			nameParts = nameParts[:len(nameParts)-1]
 		}
 
-		otherNames = strings.Join(nameParts, " ")
+		lastName = strings.Join(lastParts, " ")
 	}
 
-	if otherNames != "" {
-		otherNames += " "
+	return lastName, nameParts
+}
+
+// name components, as needed by structured export formats
+type personalName struct {
+	family    string
+	given     string
+	suffix    string
+	corporate bool
+}
+
+func splitName(name string) personalName {
+	// splits a name in either bibliographic or reading order into its components,
+	// using the same heuristics as readingOrder() and abbreviateName().  names with
+	// parentheses (or consisting of a single word) are assumed to be corporate names.
+
+	name = strings.TrimSpace(name)
+
+	if name == "" || strings.Contains(name, ")") == true || strings.Contains(name, "(") == true {
+		return personalName{family: name, corporate: true}
 	}
 
-	return fmt.Sprintf("%s%s%s", otherNames, lastName, suffixes)
+	commaParts := wordsBySeparator(name, ",")
+
+	// remove any life dates, e.g. "Smith, John, 1900-1980"
+	if len(commaParts) > 1 && re.year.MatchString(commaParts[len(commaParts)-1]) == true {
+		commaParts = commaParts[:len(commaParts)-1]
+	}
+
+	var suffixParts []string
+
+	for len(commaParts) > 1 && nameSuffixMap[commaParts[len(commaParts)-1]] == true {
+		suffixParts = append([]string{commaParts[len(commaParts)-1]}, suffixParts...)
+		commaParts = commaParts[:len(commaParts)-1]
+	}
+
+	n := personalName{suffix: strings.Join(suffixParts, ", ")}
+
+	switch {
+	case len(commaParts) > 1:
+		n.family = commaParts[0]
+		n.given = strings.Join(commaParts[1:], ", ")
+
+	case len(commaParts) == 1:
+		nameParts := wordsBySeparator(commaParts[0], " ")
+
+		if len(nameParts) == 1 {
+			return personalName{family: nameParts[0], corporate: true}
+		}
+
+		var givenParts []string
+		n.family, givenParts = extractLastName(nameParts)
+		n.given = strings.Join(givenParts, " ")
+	}
+
+	n.family = cleanEndPunctuation(n.family)
+	n.given = cleanEndPunctuation(n.given)
+
+	return n
 }
 
 func abbreviateName(name string) string {
@@ -860,6 +949,22 @@ func monthName(m int) string {
 	return t.String()
 }
 
+func isoDate(y, m, d int) string {
+	// date with as much precision as is known, e.g. "2020", "2020-03", "2020-03-15"
+	switch {
+	case y == 0:
+		return ""
+
+	case m == 0:
+		return fmt.Sprintf("%04d", y)
+
+	case d == 0:
+		return fmt.Sprintf("%04d-%02d", y, m)
+	}
+
+	return fmt.Sprintf("%04d-%02d-%02d", y, m, d)
+}
+
 func appendWithComma(str, part string) string {
 	if part == "" {
 		return str
@@ -1,23 +1,57 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
 
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 func (p *serviceContext) citationHandler(c *clientContext, json bool, citations []citationType) {
 	s := citationsContext{}
 	s.init(p, c)
 
+	for _, citation := range citations {
+		c.styles = append(c.styles, citation.Label())
+	}
+
 	c.logRequest()
+
+	ctx, span := s.startSpan("citationHandler", trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(
+		attribute.String("http.route", c.ginCtx.FullPath()),
+		attribute.StringSlice("citation.styles", c.styles),
+		attribute.String("citation.item", s.url),
+	))
+	s.ctx = ctx
+
+	s.serveCitations(json, citations)
+
+	// only server errors are span errors; the rest are the caller's problem
+	status := c.ginCtx.Writer.Status()
+	if status >= http.StatusInternalServerError {
+		span.SetStatus(codes.Error, http.StatusText(status))
+	}
+
+	endSpan(span, status, nil)
+}
+
+func (s *citationsContext) serveCitations(json bool, citations []citationType) {
+	c := s.client
+
 	resp := s.handleCitationRequest(citations)
-	c.logResponse(resp)
+	c.logResponse(resp, s.logAttrs()...)
+
+	if s.pool != nil {
+		c.ginCtx.Header("X-Virgo-Pool", s.pool.id)
+	}
 
 	if resp.err != nil {
-		c.ginCtx.String(resp.status, resp.err.Error())
+		c.serveError(resp)
 		return
 	}
 
@@ -49,6 +83,20 @@ func (p *serviceContext) apaHandler(c *gin.Context) {
 	p.citationHandler(&cl, true, []citationType{newApaEncoder(p.config.Formats.APA, true)})
 }
 
+func (p *serviceContext) biblatexHandler(c *gin.Context) {
+	cl := clientContext{}
+	cl.init(p, c)
+
+	p.citationHandler(&cl, false, []citationType{newBiblatexEncoder(p.config.Formats.BibLaTeX)})
+}
+
+func (p *serviceContext) bibtexHandler(c *gin.Context) {
+	cl := clientContext{}
+	cl.init(p, c)
+
+	p.citationHandler(&cl, false, []citationType{newBibtexEncoder(p.config.Formats.BibTeX)})
+}
+
 func (p *serviceContext) citeAsHandler(c *gin.Context) {
 	cl := clientContext{}
 	cl.init(p, c)
@@ -63,6 +111,69 @@ func (p *serviceContext) cmsHandler(c *gin.Context) {
 	p.citationHandler(&cl, true, []citationType{newCmsEncoder(p.config.Formats.CMS, true)})
 }
 
+func (p *serviceContext) coinsHandler(c *gin.Context) {
+	cl := clientContext{}
+	cl.init(p, c)
+
+	p.citationHandler(&cl, false, []citationType{newCoinsEncoder(p.config.Formats.COinS, p.config.OpenURL.ReferrerID)})
+}
+
+func (p *serviceContext) cslHandler(c *gin.Context) {
+	cl := clientContext{}
+	cl.init(p, c)
+
+	citation, err := p.cslEncoder(c)
+	if err != nil {
+		cl.logRequest()
+		p.requestError(&cl, http.StatusBadRequest, err)
+		return
+	}
+
+	p.citationHandler(&cl, true, []citationType{citation})
+}
+
+func (p *serviceContext) cslJSONHandler(c *gin.Context) {
+	cl := clientContext{}
+	cl.init(p, c)
+
+	p.citationHandler(&cl, false, []citationType{newCSLJSONEncoder(p.config.Formats.CSLJSON)})
+}
+
+func (p *serviceContext) dcHandler(c *gin.Context) {
+	cl := clientContext{}
+	cl.init(p, c)
+
+	citation, err := p.dcEncoder(c)
+	if err != nil {
+		cl.logRequest()
+		p.requestError(&cl, http.StatusBadRequest, err)
+		return
+	}
+
+	p.citationHandler(&cl, false, []citationType{citation})
+}
+
+func (p *serviceContext) endnoteHandler(c *gin.Context) {
+	cl := clientContext{}
+	cl.init(p, c)
+
+	p.citationHandler(&cl, false, []citationType{newEndnoteXmlEncoder(p.config.Formats.EndNote)})
+}
+
+func (p *serviceContext) enwHandler(c *gin.Context) {
+	cl := clientContext{}
+	cl.init(p, c)
+
+	p.citationHandler(&cl, false, []citationType{newEnwEncoder(p.config.Formats.Enw)})
+}
+
+func (p *serviceContext) jsonldHandler(c *gin.Context) {
+	cl := clientContext{}
+	cl.init(p, c)
+
+	p.citationHandler(&cl, false, []citationType{newJSONLDEncoder(p.config.Formats.JSONLD)})
+}
+
 func (p *serviceContext) lbbHandler(c *gin.Context) {
 	cl := clientContext{}
 	cl.init(p, c)
@@ -77,6 +188,26 @@ func (p *serviceContext) mlaHandler(c *gin.Context) {
 	p.citationHandler(&cl, true, []citationType{newMlaEncoder(p.config.Formats.MLA, true)})
 }
 
+func (p *serviceContext) modsHandler(c *gin.Context) {
+	cl := clientContext{}
+	cl.init(p, c)
+
+	p.citationHandler(&cl, false, []citationType{newModsEncoder(p.config.Formats.MODS)})
+}
+
+func (p *serviceContext) openURLHandler(c *gin.Context) {
+	cl := clientContext{}
+	cl.init(p, c)
+
+	citations := []citationType{newOpenURLEncoder(p.config.Formats.OpenURL, "", p.config.OpenURL.ReferrerID)}
+
+	if p.config.OpenURL.ResolverURL != "" {
+		citations = append(citations, newOpenURLEncoder(p.config.Formats.Resolver, p.config.OpenURL.ResolverURL, p.config.OpenURL.ReferrerID))
+	}
+
+	p.citationHandler(&cl, true, citations)
+}
+
 func (p *serviceContext) risHandler(c *gin.Context) {
 	cl := clientContext{}
 	cl.init(p, c)
@@ -125,33 +256,18 @@ func (p *serviceContext) versionHandler(c *gin.Context) {
 	c.JSON(http.StatusOK, p.version)
 }
 
-func (p *serviceContext) healthCheckHandler(c *gin.Context) {
-	cl := clientContext{}
-	cl.init(p, c)
-
-	s := citationsContext{}
-	s.init(p, &cl)
-
-	if s.client.opts.verbose == false {
-		s.client.nolog = true
-	}
-
-	// build response
-
-	type hcResp struct {
-		Healthy bool   `json:"healthy"`
-		Message string `json:"message,omitempty"`
-	}
-
-	hcMap := make(map[string]hcResp)
+func (p *serviceContext) requestError(cl *clientContext, status int, err error) {
+	resp := serviceResponse{status: status, err: err}
 
-	hcMap["self"] = hcResp{Healthy: true}
+	cl.logResponse(resp)
 
-	c.JSON(http.StatusOK, hcMap)
+	cl.serveError(resp)
 }
 
 func (s *citationsContext) getContents(citation citationType) (string, error) {
+	_, span := s.startSpan("Contents", trace.WithAttributes(attribute.String("citation.style", citation.Label())))
 	data, err := citation.Contents()
+	endSpan(span, 0, err)
 
 	if err != nil {
 		return "", err
@@ -168,7 +284,9 @@ func (s *citationsContext) serveSingleCitation(citation citationType) {
 	data, err := s.getContents(citation)
 
 	if err != nil {
-		c.String(http.StatusInternalServerError, err.Error())
+		resp := contentsErrorResponse(err)
+		s.warn("failed to generate %s citation: %s", citation.Label(), err.Error())
+		s.client.serveError(resp, citationFailure{Style: citation.Label(), Code: resp.errorCode(), Message: err.Error()})
 		return
 	}
 
@@ -203,16 +321,36 @@ func (s *citationsContext) serveMultipleCitations(citations []citationType) {
 
 	resp := []citationResp{}
 
+	var failures []citationFailure
+	var failed serviceResponse
+
 	for _, citation := range citations {
 		data, err := s.getContents(citation)
 
 		if err != nil {
-			s.log("WARNING: failed to generate %s citation: %s", citation.Label(), err.Error())
+			s.warn("failed to generate %s citation: %s", citation.Label(), err.Error())
+			failed = contentsErrorResponse(err)
+			failures = append(failures, citationFailure{Style: citation.Label(), Code: failed.errorCode(), Message: err.Error()})
 			continue
 		}
 
 		resp = append(resp, citationResp{Label: citation.Label(), Value: data})
 	}
 
+	// partial results are still results; only report an error when nothing could be generated
+	if len(resp) == 0 && len(failures) > 0 {
+		if len(failures) > 1 {
+			failed = serviceResponse{status: http.StatusInternalServerError, err: errors.New("no citations could be generated for this item")}
+		}
+
+		s.client.serveError(failed, failures...)
+		return
+	}
+
+	// the list only holds citations, so clients are told which styles are missing from it
+	for _, failure := range failures {
+		c.Writer.Header().Add("X-Virgo-Failed-Style", failure.Style+"; code="+failure.Code)
+	}
+
 	c.JSON(http.StatusOK, resp)
 }
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// a citation with fixed contents
+type testCitation struct {
+	label    string
+	contents string
+	err      error
+}
+
+func (t testCitation) Init(c *clientContext, url string)  {}
+func (t testCitation) Populate(parts citationParts) error { return nil }
+func (t testCitation) Label() string                      { return t.label }
+func (t testCitation) ContentType() string                { return "text/plain" }
+func (t testCitation) FileName() string                   { return "" }
+func (t testCitation) Contents() (string, error)          { return t.contents, t.err }
+
+func TestServeMultipleCitations(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	p := &serviceContext{randomSource: rand.New(rand.NewSource(1))}
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("GET", "/format/all", nil)
+
+	cl := clientContext{}
+	cl.init(p, c)
+
+	s := citationsContext{}
+	s.initWithURL(p, &cl, "")
+
+	s.serveMultipleCitations([]citationType{
+		testCitation{label: "MLA", contents: "an mla citation"},
+		testCitation{label: "APA", err: errors.New("no apa for you")},
+	})
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+
+	var resp []map[string]string
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+
+	// failed styles stay out of the list, so that every entry is a citation
+	if len(resp) != 1 || resp[0]["label"] != "MLA" || resp[0]["value"] != "an mla citation" {
+		t.Errorf("response = %v, want just the MLA citation", resp)
+	}
+
+	if failed := w.Header().Values("X-Virgo-Failed-Style"); len(failed) != 1 || failed[0] != "APA; code=internal" {
+		t.Errorf("X-Virgo-Failed-Style = %v, want [APA; code=internal]", failed)
+	}
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/uvalib/virgo4-jwt/v4jwt"
+	"golang.org/x/sync/singleflight"
+)
+
+type hcResp struct {
+	Healthy bool   `json:"healthy"`
+	Message string `json:"message,omitempty"`
+	Latency *int64 `json:"latency_ms,omitempty"` // for probed dependencies
+}
+
+// results of the most recent dependency probes, which are only repeated once
+// they are older than the configured interval, so that frequent health checks
+// (e.g. from load balancers) do not translate into frequent pool requests
+type healthProbes struct {
+	mutex    sync.Mutex // guards results and expires only; never held while probing
+	inflight singleflight.Group
+	interval time.Duration
+	results  map[string]hcResp
+	expires  time.Time
+}
+
+type healthProbe struct {
+	name  string
+	check func() error
+}
+
+func (p *serviceContext) initHealth() {
+	interval := integerWithMinimum(p.config.Health.Interval, 10)
+
+	p.health = &healthProbes{
+		interval: time.Duration(interval) * time.Second,
+	}
+
+	log.Printf("[HEALTH] probe interval = %ds, canaries = %v", interval, p.config.Health.Canaries)
+}
+
+func (p *serviceContext) healthProbeList() []healthProbe {
+	var probes []healthProbe
+
+	probes = append(probes, healthProbe{name: "jwt", check: p.checkJWT})
+
+	// a lightweight ping of each pool known to the registry
+
+	if p.registry.enabled() == true {
+		p.registry.mutex.RLock()
+		for _, pool := range p.registry.pools {
+			probes = append(probes, healthProbe{name: "pool:" + pool.id, check: func() error {
+				return p.pingPool(pool)
+			}})
+		}
+		p.registry.mutex.RUnlock()
+	}
+
+	// a full request for each canary item
+
+	for _, item := range p.config.Health.Canaries {
+		probes = append(probes, healthProbe{name: "canary:" + item, check: func() error {
+			return p.checkCanary(item)
+		}})
+	}
+
+	return probes
+}
+
+func (p *serviceContext) probeHealth() map[string]hcResp {
+	p.health.mutex.Lock()
+	results, expires := p.health.results, p.health.expires
+	p.health.mutex.Unlock()
+
+	if results != nil && time.Now().Before(expires) {
+		return results
+	}
+
+	// one round of probes at a time.  only the very first health check waits for it;
+	// later ones get the previous results while it runs, so a stalled pool cannot stall them.
+	ch := p.health.inflight.DoChan("probes", func() (interface{}, error) {
+		return p.runHealthProbes(), nil
+	})
+
+	if results != nil {
+		return results
+	}
+
+	res := <-ch
+
+	return res.Val.(map[string]hcResp)
+}
+
+func (p *serviceContext) runHealthProbes() map[string]hcResp {
+	probes := p.healthProbeList()
+	results := make([]hcResp, len(probes))
+
+	var wg sync.WaitGroup
+
+	for i, probe := range probes {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			start := time.Now()
+			err := probe.check()
+			latency := int64(time.Since(start) / time.Millisecond)
+
+			results[i] = hcResp{Healthy: err == nil, Latency: &latency}
+
+			if err != nil {
+				results[i].Message = err.Error()
+				log.Printf("[HEALTH] %s is unhealthy: %s", probe.name, err.Error())
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	resultsMap := make(map[string]hcResp)
+
+	for i, probe := range probes {
+		resultsMap[probe.name] = results[i]
+	}
+
+	p.health.mutex.Lock()
+	p.health.results = resultsMap
+	p.health.expires = time.Now().Add(p.health.interval)
+	p.health.mutex.Unlock()
+
+	return resultsMap
+}
+
+func (p *serviceContext) checkJWT() error {
+	// make sure tokens can be minted for pool requests, and can be read back
+	if p.config.JWT.Key == "" {
+		return errors.New("no JWT key configured")
+	}
+
+	token, err := v4jwt.Mint(p.auth.claims, time.Duration(p.config.JWT.Expiration)*time.Minute, p.config.JWT.Key)
+	if err != nil {
+		return fmt.Errorf("failed to mint JWT: %s", err.Error())
+	}
+
+	if _, err := v4jwt.Validate(token, p.config.JWT.Key); err != nil {
+		return fmt.Errorf("failed to validate JWT: %s", err.Error())
+	}
+
+	return nil
+}
+
+func (p *serviceContext) pingPool(pool *poolRegistryEntry) error {
+	pingURL := pool.url + "/version"
+
+	if err := p.pools.allowlist.check(pingURL); err != nil {
+		return err
+	}
+
+	res, err := p.pools.client.Get(pingURL)
+	if err != nil {
+		return errors.New("no response from pool")
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("received pool response code %d", res.StatusCode)
+	}
+
+	return nil
+}
+
+func (p *serviceContext) checkCanary(item string) error {
+	// probe the same request citation requests make for their records, but only once, and
+	// without the cache, circuit breaker, or metrics, so that a failing canary cannot affect
+	// real requests (or how they look)
+	cl := clientContext{reqID: "health", nolog: true, logger: p.logger}
+
+	s := citationsContext{}
+	s.initWithURL(p, &cl, item)
+
+	req, resp := s.poolRecordRequest(context.Background())
+	if resp.err != nil {
+		return resp.err
+	}
+
+	rec, resp, _, _ := s.attemptPoolRecord(req)
+	if resp.err != nil {
+		return resp.err
+	}
+
+	if len(citationPartsFromRecord(rec)) == 0 {
+		return errors.New("canary item has no citation parts")
+	}
+
+	return nil
+}
+
+func (p *serviceContext) healthCheckHandler(c *gin.Context) {
+	cl := clientContext{}
+	cl.init(p, c)
+
+	if cl.opts.verbose == false {
+		cl.nolog = true
+	}
+
+	// build response
+
+	hcMap := make(map[string]hcResp)
+
+	hcMap["self"] = hcResp{Healthy: true}
+
+	if p.registry.enabled() == true {
+		hc := hcResp{Healthy: p.registry.available()}
+
+		if hc.Healthy == false {
+			hc.Message = "no pools loaded from pool registry"
+		}
+
+		hcMap["registry"] = hc
+	}
+
+	for name, hc := range p.probeHealth() {
+		hcMap[name] = hc
+	}
+
+	// pools this service has talked to, as seen by their circuit breakers
+
+	for _, b := range p.pools.breaker.status() {
+		hc := hcResp{Healthy: b.state == breakerClosed}
+
+		if hc.Healthy == false {
+			hc.Message = fmt.Sprintf("circuit breaker %s after %d consecutive failure(s)", b.state, b.failures)
+		}
+
+		hcMap["breaker:"+b.pool] = hc
+	}
+
+	// this service cannot query any pools without valid tokens
+	status := http.StatusOK
+	if hcMap["jwt"].Healthy == false {
+		status = http.StatusInternalServerError
+	}
+
+	c.JSON(status, hcMap)
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+
+	"github.com/microcosm-cc/bluemonday"
+)
+
+// schema.org types
+const jsonldTypeBook = "Book"
+const jsonldTypeBookSeries = "BookSeries"
+const jsonldTypeCreativeWork = "CreativeWork"
+const jsonldTypeManuscript = "Manuscript"
+const jsonldTypeMap = "Map"
+const jsonldTypeMovie = "Movie"
+const jsonldTypeMusicComposition = "MusicComposition"
+const jsonldTypeMusicRecording = "MusicRecording"
+const jsonldTypeNewsArticle = "NewsArticle"
+const jsonldTypeOrganization = "Organization"
+const jsonldTypePeriodical = "Periodical"
+const jsonldTypePerson = "Person"
+const jsonldTypePlace = "Place"
+const jsonldTypePublicationIssue = "PublicationIssue"
+const jsonldTypePublicationVolume = "PublicationVolume"
+const jsonldTypeReport = "Report"
+const jsonldTypeScholarlyArticle = "ScholarlyArticle"
+const jsonldTypeThesis = "Thesis"
+const jsonldTypeVisualArtwork = "VisualArtwork"
+
+type jsonldPlace struct {
+	Type string `json:"@type"`
+	Name string `json:"name"`
+}
+
+// a Person or Organization
+type jsonldAgent struct {
+	Type            string       `json:"@type"`
+	Name            string       `json:"name"`
+	GivenName       string       `json:"givenName,omitempty"`
+	FamilyName      string       `json:"familyName,omitempty"`
+	HonorificSuffix string       `json:"honorificSuffix,omitempty"`
+	Location        *jsonldPlace `json:"location,omitempty"`
+}
+
+// a link in the isPartOf chain: issue -> volume -> periodical, or a series
+type jsonldPart struct {
+	Type         string      `json:"@type"`
+	Name         string      `json:"name,omitempty"`
+	IssueNumber  string      `json:"issueNumber,omitempty"`
+	VolumeNumber string      `json:"volumeNumber,omitempty"`
+	ISSN         string      `json:"issn,omitempty"`
+	IsPartOf     *jsonldPart `json:"isPartOf,omitempty"`
+}
+
+type jsonldWork struct {
+	Context       string        `json:"@context"`
+	Type          string        `json:"@type"`
+	ID            string        `json:"@id,omitempty"`
+	URL           string        `json:"url,omitempty"`
+	Name          string        `json:"name,omitempty"`
+	Author        []jsonldAgent `json:"author,omitempty"`
+	Editor        []jsonldAgent `json:"editor,omitempty"`
+	Translator    []jsonldAgent `json:"translator,omitempty"`
+	Contributor   []jsonldAgent `json:"contributor,omitempty"`
+	DatePublished string        `json:"datePublished,omitempty"`
+	Publisher     *jsonldAgent  `json:"publisher,omitempty"`
+	BookEdition   string        `json:"bookEdition,omitempty"`
+	ISBN          string        `json:"isbn,omitempty"`
+	ISSN          string        `json:"issn,omitempty"`
+	IsPartOf      *jsonldPart   `json:"isPartOf,omitempty"`
+	PageStart     string        `json:"pageStart,omitempty"`
+	PageEnd       string        `json:"pageEnd,omitempty"`
+	Genre         string        `json:"genre,omitempty"`
+	InLanguage    string        `json:"inLanguage,omitempty"`
+	Keywords      string        `json:"keywords,omitempty"`
+	Abstract      string        `json:"abstract,omitempty"`
+	SameAs        []string      `json:"sameAs,omitempty"`
+}
+
+type jsonldEncoder struct {
+	cfg    serviceConfigFormat
+	url    string
+	work   jsonldWork
+	policy *bluemonday.Policy
+}
+
+var jsonldTypesMap map[string]string
+
+func newJSONLDEncoder(cfg serviceConfigFormat) *jsonldEncoder {
+	e := jsonldEncoder{}
+
+	e.cfg = cfg
+	e.policy = bluemonday.StrictPolicy()
+
+	return &e
+}
+
+func (e *jsonldEncoder) Init(c *clientContext, url string) {
+	e.url = url
+}
+
+func (e *jsonldEncoder) Populate(parts citationParts) error {
+	data, err := newRawCitation(e.url, parts)
+	if err != nil {
+		return err
+	}
+
+	w := jsonldWork{Context: "https://schema.org"}
+
+	w.Type = jsonldTypeCreativeWork
+	if workType, ok := jsonldTypesMap[data.format]; ok == true {
+		w.Type = workType
+	}
+
+	w.ID = e.url
+	w.URL = e.url
+	w.Name = e.cleanString(data.title)
+
+	w.Author = e.agents(data.authors)
+	w.Editor = e.agents(data.editors)
+	w.Translator = e.agents(data.translators)
+	w.Contributor = append(e.agents(data.advisors), e.agents(data.compilers)...)
+
+	if data.year != 0 {
+		w.DatePublished = isoDate(data.year, data.month, data.day)
+	}
+
+	if publisher := e.cleanString(data.publisher); publisher != "" {
+		w.Publisher = &jsonldAgent{Type: jsonldTypeOrganization, Name: publisher}
+
+		if place := e.cleanString(cleanEndPunctuation(firstElementOf(parts["published_location"]))); place != "" {
+			w.Publisher.Location = &jsonldPlace{Type: jsonldTypePlace, Name: place}
+		}
+	}
+
+	serialNumber := e.cleanString(firstElementOf(parts["serial_number"]))
+
+	switch w.Type {
+	case jsonldTypeScholarlyArticle, jsonldTypeNewsArticle:
+		w.IsPartOf = e.periodicalChain(data, serialNumber)
+		w.PageStart = data.pageFrom
+		w.PageEnd = data.pageTo
+
+	case jsonldTypePeriodical:
+		w.ISSN = serialNumber
+
+	default:
+		w.ISBN = serialNumber
+		w.BookEdition = e.cleanString(cleanEndPunctuation(firstElementOf(parts["edition"])))
+
+		if series := e.cleanString(firstElementOf(parts["series"])); series != "" {
+			w.IsPartOf = &jsonldPart{Type: jsonldTypeBookSeries, Name: series}
+		}
+	}
+
+	w.Genre = e.cleanString(firstElementOf(parts["genre"]))
+	w.InLanguage = e.cleanString(firstElementOf(parts["language"]))
+	w.Keywords = e.cleanString(strings.Join(parts["subject"], ", "))
+	w.Abstract = e.cleanString(strings.Join(parts["abstract"], " "))
+
+	if doi := re.doiPrefix.ReplaceAllString(e.cleanString(firstElementOf(parts["doi"])), ""); doi != "" {
+		w.SameAs = append(w.SameAs, "https://doi.org/"+doi)
+	}
+
+	for _, url := range parts["url"] {
+		if u := e.cleanString(url); u != "" && u != e.url && sliceContainsString(w.SameAs, u) == false {
+			w.SameAs = append(w.SameAs, u)
+		}
+	}
+
+	e.work = w
+
+	return nil
+}
+
+func (e *jsonldEncoder) periodicalChain(data *genericCitation, issn string) *jsonldPart {
+	// builds the chain from the outermost (periodical) to the innermost (issue) level,
+	// skipping any levels not present in the record
+	var part *jsonldPart
+
+	if journal := e.cleanString(data.journal); journal != "" {
+		part = &jsonldPart{Type: jsonldTypePeriodical, Name: journal, ISSN: issn}
+	}
+
+	if volume := e.cleanString(data.volume); volume != "" {
+		part = &jsonldPart{Type: jsonldTypePublicationVolume, VolumeNumber: volume, IsPartOf: part}
+	}
+
+	if issue := e.cleanString(data.issue); issue != "" {
+		part = &jsonldPart{Type: jsonldTypePublicationIssue, IssueNumber: issue, IsPartOf: part}
+	}
+
+	return part
+}
+
+func (e *jsonldEncoder) agents(names []string) []jsonldAgent {
+	var agents []jsonldAgent
+
+	for _, name := range names {
+		cleaned := e.cleanString(name)
+		n := splitName(cleaned)
+
+		switch {
+		case n.family == "":
+			continue
+
+		// corporate names are guessed the same way as in the other formats
+		case n.corporate == true:
+			agents = append(agents, jsonldAgent{Type: jsonldTypeOrganization, Name: n.family})
+
+		default:
+			fullName := strings.TrimSpace(n.given + " " + n.family)
+			if n.suffix != "" {
+				fullName += ", " + n.suffix
+			}
+
+			agents = append(agents, jsonldAgent{
+				Type:            jsonldTypePerson,
+				Name:            fullName,
+				GivenName:       n.given,
+				FamilyName:      n.family,
+				HonorificSuffix: n.suffix,
+			})
+		}
+	}
+
+	return agents
+}
+
+func (e *jsonldEncoder) cleanString(val string) string {
+	return plainText(e.policy, val)
+}
+
+func (e *jsonldEncoder) Label() string {
+	return e.cfg.Label
+}
+
+func (e *jsonldEncoder) ContentType() string {
+	return e.cfg.ContentType
+}
+
+func (e *jsonldEncoder) FileName() string {
+	return ""
+}
+
+func (e *jsonldEncoder) Contents() (string, error) {
+	var b bytes.Buffer
+
+	// html stays escaped (<, >, &), since this is meant to be embedded in a <script> element
+	enc := json.NewEncoder(&b)
+	enc.SetIndent("", "  ")
+
+	if err := enc.Encode(e.work); err != nil {
+		return "", err
+	}
+
+	return b.String(), nil
+}
+
+func init() {
+	// mapping of citation formats (citation part "format") to schema.org type
+	jsonldTypesMap = make(map[string]string)
+
+	jsonldTypesMap["art"] = jsonldTypeVisualArtwork
+	jsonldTypesMap["article"] = jsonldTypeScholarlyArticle
+	jsonldTypesMap["book"] = jsonldTypeBook
+	jsonldTypesMap["government_document"] = jsonldTypeReport
+	jsonldTypesMap["journal"] = jsonldTypePeriodical
+	jsonldTypesMap["manuscript"] = jsonldTypeManuscript
+	jsonldTypesMap["map"] = jsonldTypeMap
+	jsonldTypesMap["music"] = jsonldTypeMusicComposition
+	jsonldTypesMap["news"] = jsonldTypeNewsArticle
+	jsonldTypesMap["sound"] = jsonldTypeMusicRecording
+	jsonldTypesMap["thesis"] = jsonldTypeThesis
+	jsonldTypesMap["video"] = jsonldTypeMovie
+}
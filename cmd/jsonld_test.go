@@ -0,0 +1,34 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestJSONLDScriptEscaping(t *testing.T) {
+	titles := []string{
+		"</script><script>alert(1)</script>",
+		"&lt;/script&gt;&lt;script&gt;alert(1)&lt;/script&gt;",
+		"&lt;/SCRIPT&gt; &amp; <!-- comment -->",
+	}
+
+	for _, title := range titles {
+		e := newJSONLDEncoder(serviceConfigFormat{})
+		e.Init(nil, "https://pool.example.org/api/resource/u1")
+
+		err := e.Populate(citationParts{
+			"format": {"book"},
+			"title":  {title},
+			"author": {title},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		contents, _ := e.Contents()
+
+		if strings.Contains(strings.ToLower(contents), "</script") == true || strings.Contains(contents, "<!--") == true {
+			t.Errorf("title %q: unescaped html in:\n%s", title, contents)
+		}
+	}
+}
@@ -345,6 +345,7 @@ func (e *lbbEncoder) Contents() (string, error) {
 	default:
 		// book format is a good fallback since it uses several common generic fields.
 		// this should at least generate a minimal citation, even if it's not correct.
+		metrics.fallbackFormat("lbb")
 		return e.bookCitation(), nil
 	}
 }
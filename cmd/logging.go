@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"log/slog"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// log formats
+const (
+	logFormatText = "text"
+	logFormatJSON = "json"
+)
+
+const requestIDHeader = "X-Request-ID"
+
+// inbound request ids are passed along to pools, so only accept reasonable ones
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,64}$`)
+
+func (p *serviceContext) initLogging() {
+	format := p.config.Logging.Format
+	if format == "" {
+		format = logFormatText
+	}
+
+	switch format {
+	case logFormatText:
+
+	case logFormatJSON:
+		// this also sends anything logged with the standard logger through slog
+		p.logger = slog.New(slog.NewJSONHandler(os.Stdout, nil))
+		slog.SetDefault(p.logger)
+
+	default:
+		log.Printf("invalid log format: [%s]", format)
+		os.Exit(1)
+	}
+
+	log.Printf("[LOGGING] format = %s", format)
+}
+
+func (c *clientContext) initRequestID(p *serviceContext) {
+	// join this request's logs with those of the caller, when given a request id
+	if reqID := c.ginCtx.GetHeader(requestIDHeader); validRequestID.MatchString(reqID) == true {
+		c.reqID = reqID
+	} else {
+		c.reqID = fmt.Sprintf("%08x", p.randomSource.Uint32())
+	}
+
+	c.ginCtx.Header(requestIDHeader, c.reqID)
+}
+
+func (c *clientContext) logAttrs() []slog.Attr {
+	attrs := []slog.Attr{slog.String("request_id", c.reqID)}
+
+	if c.ginCtx != nil && c.ginCtx.FullPath() != "" {
+		attrs = append(attrs, slog.String("endpoint", c.ginCtx.FullPath()))
+	}
+
+	if len(c.styles) > 0 {
+		attrs = append(attrs, slog.Any("styles", c.styles))
+	}
+
+	return attrs
+}
+
+func (s *citationsContext) logAttrs() []slog.Attr {
+	var attrs []slog.Attr
+
+	if s.url == "" {
+		return attrs
+	}
+
+	attrs = append(attrs, slog.String("item", s.url))
+
+	if u, err := url.Parse(s.url); err == nil && u.Host != "" {
+		attrs = append(attrs, slog.String("pool_host", u.Host))
+	}
+
+	if s.pool != nil {
+		attrs = append(attrs, slog.String("pool", s.pool.id))
+	}
+
+	if s.ctx != nil {
+		if sc := trace.SpanContextFromContext(s.ctx); sc.IsValid() == true {
+			attrs = append(attrs, slog.String("trace_id", sc.TraceID().String()))
+		}
+	}
+
+	if s.poolLatency > 0 {
+		attrs = append(attrs, slog.Int64("pool_latency_ms", s.poolLatency.Milliseconds()))
+	}
+
+	return attrs
+}
+
+func (c *clientContext) output(prefix string, attrs []slog.Attr, format string, args ...interface{}) {
+	str := fmt.Sprintf(format, args...)
+
+	if c.logger == nil {
+		if prefix != "" {
+			str = strings.Join([]string{prefix, str}, " ")
+		}
+
+		log.Printf("[%s] %s", c.reqID, str)
+		return
+	}
+
+	level := slog.LevelInfo
+
+	switch prefix {
+	case "WARNING:":
+		level = slog.LevelWarn
+	case "ERROR:":
+		level = slog.LevelError
+	}
+
+	c.logger.LogAttrs(context.Background(), level, str, append(c.logAttrs(), attrs...)...)
+}
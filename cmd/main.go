@@ -6,9 +6,9 @@ import (
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
-	//"github.com/prometheus/client_golang/prometheus"
-	//"github.com/prometheus/client_golang/prometheus/promhttp"
-	//ginprometheus "github.com/zsais/go-gin-prometheus"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	ginprometheus "github.com/zsais/go-gin-prometheus"
 )
 
 /*
@@ -23,7 +23,12 @@ func main() {
 	gin.SetMode(gin.ReleaseMode)
 	gin.DisableConsoleColor()
 
-	router := gin.Default()
+	// gin's own request logging is not structured, and is redundant with ours
+	router := gin.New()
+	if svc.logger == nil {
+		router.Use(gin.Logger())
+	}
+	router.Use(gin.Recovery())
 
 	corsCfg := cors.DefaultConfig()
 	corsCfg.AllowAllOrigins = true
@@ -31,35 +36,53 @@ func main() {
 	corsCfg.AddAllowHeaders("Authorization")
 	router.Use(cors.New(corsCfg))
 
-	//
-	// we are removing Prometheus support for now
-	//
-	//p := ginprometheus.NewPrometheus("gin")
+	p := ginprometheus.NewPrometheus("gin")
+
+	// label requests by route rather than by url, which would add a series per item (and per random path)
+	p.ReqCntURLLabelMappingFn = func(c *gin.Context) string {
+		return c.FullPath()
+	}
 
 	// roundabout setup of /metrics endpoint to avoid extra gzip of response
-	//router.Use(p.HandlerFunc())
-	//h := promhttp.InstrumentMetricHandler(prometheus.DefaultRegisterer, promhttp.HandlerFor(prometheus.DefaultGatherer, promhttp.HandlerOpts{DisableCompression: true}))
+	router.Use(p.HandlerFunc())
+	h := promhttp.InstrumentMetricHandler(prometheus.DefaultRegisterer, promhttp.HandlerFor(prometheus.DefaultGatherer, promhttp.HandlerOpts{DisableCompression: true}))
 
-	//router.GET(p.MetricsPath, func(c *gin.Context) {
-	//	h.ServeHTTP(c.Writer, c.Request)
-	//})
+	router.GET(p.MetricsPath, func(c *gin.Context) {
+		h.ServeHTTP(c.Writer, c.Request)
+	})
 
 	router.GET("/favicon.ico", svc.ignoreHandler)
 
 	router.GET("/version", svc.versionHandler)
 	router.GET("/healthcheck", svc.healthCheckHandler)
 
-	if format := router.Group("/format"); format != nil {
+	if format := router.Group("/format", svc.metricsHandler, svc.authenticateHandler); format != nil {
 		format.GET("/all", svc.allHandler)
 		format.GET("/apa", svc.apaHandler)
+		format.GET("/biblatex", svc.biblatexHandler)
+		format.GET("/bibtex", svc.bibtexHandler)
 		format.GET("/citeas", svc.citeAsHandler)
 		format.GET("/cms", svc.cmsHandler)
+		format.GET("/coins", svc.coinsHandler)
+		format.GET("/csl", svc.cslHandler)
+		format.GET("/csl-json", svc.cslJSONHandler)
+		format.GET("/dc", svc.dcHandler)
+		format.GET("/endnote", svc.endnoteHandler)
+		format.GET("/enw", svc.enwHandler)
+		format.GET("/jsonld", svc.jsonldHandler)
 		format.GET("/mla", svc.mlaHandler)
+		format.GET("/mods", svc.modsHandler)
+		format.GET("/openurl", svc.openURLHandler)
 		format.GET("/lbb", svc.lbbHandler)
 		format.GET("/ris", svc.risHandler)
+
+		format.POST("/:style", svc.recordHandler)
+		format.POST("/:style/batch", svc.batchHandler)
 	}
 
-	router.GET("/unapi", svc.unapiHandler) // unAPI endpoint for Zotero
+	router.GET("/citation", svc.metricsHandler, svc.authenticateHandler, svc.negotiationHandler) // content negotiation, as with dois
+
+	router.GET("/unapi", svc.metricsHandler, svc.authenticateHandler, svc.unapiHandler) // unAPI endpoint for Zotero
 
 	portStr := fmt.Sprintf(":%s", svc.config.Port)
 	log.Printf("[MAIN] listening on %s", portStr)
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const metricsNamespace = "virgo4_citations"
+
+// service-specific prometheus series, in addition to the generic gin ones.
+// these are global since they are also updated from within the citation encoders.
+type serviceMetrics struct {
+	requests        *prometheus.CounterVec
+	requestDuration *prometheus.HistogramVec
+	poolRequests    *prometheus.CounterVec
+	poolDuration    *prometheus.HistogramVec
+	cacheLookups    *prometheus.CounterVec
+	noExplicit      prometheus.Counter
+	fallbackFormats *prometheus.CounterVec
+}
+
+var metrics = serviceMetrics{
+	requests: promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "requests_total",
+		Help:      "Citation requests, by style, route, and response status.",
+	}, []string{"style", "route", "status"}),
+
+	requestDuration: promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "request_duration_seconds",
+		Help:      "Citation request latency, by style and route.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"style", "route"}),
+
+	poolRequests: promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "pool_requests_total",
+		Help:      "Pool record requests, by pool (registry id, or other) and result (ok, timeout, refused, error, invalid, not_allowed, circuit_open, or the response status).",
+	}, []string{"pool", "result"}),
+
+	poolDuration: promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "pool_request_duration_seconds",
+		Help:      "Pool record request latency, by pool (registry id, or other).",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"pool"}),
+
+	cacheLookups: promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "cache_lookups_total",
+		Help:      "Pool record cache lookups, by result (hit, miss, or bypass).",
+	}, []string{"result"}),
+
+	noExplicit: promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "no_explicit_citation_total",
+		Help:      "Requests for an explicit (cite as) citation of an item that has none.",
+	}),
+
+	fallbackFormats: promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "fallback_formats_total",
+		Help:      "Citations generated using a style's generic type, because the item's format is unknown to it.",
+	}, []string{"style"}),
+}
+
+func (m *serviceMetrics) poolRequest(pool, result string, elapsed time.Duration) {
+	m.poolRequests.WithLabelValues(pool, result).Inc()
+	m.poolDuration.WithLabelValues(pool).Observe(elapsed.Seconds())
+}
+
+// requests that were never made, so have no latency
+func (m *serviceMetrics) poolRequestSkipped(pool, result string) {
+	m.poolRequests.WithLabelValues(pool, result).Inc()
+}
+
+func (m *serviceMetrics) cacheLookup(result string) {
+	m.cacheLookups.WithLabelValues(result).Inc()
+}
+
+func (m *serviceMetrics) noExplicitCitation() {
+	m.noExplicit.Inc()
+}
+
+func (m *serviceMetrics) fallbackFormat(style string) {
+	m.fallbackFormats.WithLabelValues(style).Inc()
+}
+
+func (p *serviceContext) metricsHandler(c *gin.Context) {
+	start := time.Now()
+
+	c.Next()
+
+	// styles are named after their endpoints, or given as a path parameter.
+	// the latter can be anything, so only known styles get their own series.
+	route := c.FullPath()
+
+	style := c.Param("style")
+	if style == "" {
+		style = path.Base(route)
+	} else if _, ok := citationStyles[style]; ok == false {
+		style = "unknown"
+	}
+
+	metrics.requests.WithLabelValues(style, route, strconv.Itoa(c.Writer.Status())).Inc()
+	metrics.requestDuration.WithLabelValues(style, route).Observe(time.Since(start).Seconds())
+}
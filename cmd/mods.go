@@ -0,0 +1,383 @@
+package main
+
+import (
+	"encoding/xml"
+	"strings"
+
+	"github.com/microcosm-cc/bluemonday"
+)
+
+// MODS namespace and version generated
+const modsNamespace = "http://www.loc.gov/mods/v3"
+const modsSchemaLocation = "http://www.loc.gov/mods/v3 http://www.loc.gov/standards/mods/v3/mods-3-7.xsd"
+const modsVersion = "3.7"
+
+// MODS resource types
+const modsResourceCartographic = "cartographic"
+const modsResourceMixed = "mixed material"
+const modsResourceMovingImage = "moving image"
+const modsResourceNotatedMusic = "notated music"
+const modsResourceSoundRecording = "sound recording"
+const modsResourceStillImage = "still image"
+const modsResourceText = "text"
+
+// MARC relator terms and codes for the roles the service distinguishes
+type modsRelator struct {
+	term string
+	code string
+}
+
+var modsRelatorAdvisor = modsRelator{term: "thesis advisor", code: "ths"}
+var modsRelatorAuthor = modsRelator{term: "author", code: "aut"}
+var modsRelatorCompiler = modsRelator{term: "compiler", code: "com"}
+var modsRelatorEditor = modsRelator{term: "editor", code: "edt"}
+var modsRelatorTranslator = modsRelator{term: "translator", code: "trl"}
+
+type modsTypedText struct {
+	Type      string `xml:"type,attr,omitempty"`
+	Authority string `xml:"authority,attr,omitempty"`
+	Value     string `xml:",chardata"`
+}
+
+type modsTitleInfo struct {
+	Title    string `xml:"title"`
+	SubTitle string `xml:"subTitle,omitempty"`
+}
+
+type modsRole struct {
+	RoleTerms []modsTypedText `xml:"roleTerm"`
+}
+
+type modsName struct {
+	Type        string          `xml:"type,attr"`
+	NameParts   []modsTypedText `xml:"namePart"`
+	DisplayForm string          `xml:"displayForm,omitempty"`
+	Role        modsRole        `xml:"role"`
+}
+
+type modsPlace struct {
+	PlaceTerm modsTypedText `xml:"placeTerm"`
+}
+
+type modsDate struct {
+	Encoding string `xml:"encoding,attr,omitempty"`
+	KeyDate  string `xml:"keyDate,attr,omitempty"`
+	Value    string `xml:",chardata"`
+}
+
+type modsOriginInfo struct {
+	Place      *modsPlace `xml:"place,omitempty"`
+	Publisher  string     `xml:"publisher,omitempty"`
+	DateIssued *modsDate  `xml:"dateIssued,omitempty"`
+	Edition    string     `xml:"edition,omitempty"`
+}
+
+type modsLanguage struct {
+	LanguageTerm modsTypedText `xml:"languageTerm"`
+}
+
+type modsSubject struct {
+	Topic string `xml:"topic"`
+}
+
+type modsDetail struct {
+	Type   string `xml:"type,attr"`
+	Number string `xml:"number"`
+}
+
+type modsExtent struct {
+	Unit  string `xml:"unit,attr"`
+	Start string `xml:"start,omitempty"`
+	End   string `xml:"end,omitempty"`
+}
+
+type modsPart struct {
+	Details []modsDetail `xml:"detail"`
+	Extent  *modsExtent  `xml:"extent,omitempty"`
+}
+
+type modsRelatedItem struct {
+	Type      string        `xml:"type,attr"`
+	TitleInfo modsTitleInfo `xml:"titleInfo"`
+	Part      *modsPart     `xml:"part,omitempty"`
+}
+
+type modsURL struct {
+	Usage  string `xml:"usage,attr,omitempty"`
+	Access string `xml:"access,attr,omitempty"`
+	Value  string `xml:",chardata"`
+}
+
+type modsLocation struct {
+	ShelfLocator string    `xml:"shelfLocator,omitempty"`
+	URLs         []modsURL `xml:"url"`
+}
+
+type modsRecord struct {
+	XMLName         xml.Name          `xml:"mods"`
+	Namespace       string            `xml:"xmlns,attr"`
+	XSINamespace    string            `xml:"xmlns:xsi,attr"`
+	SchemaLocation  string            `xml:"xsi:schemaLocation,attr"`
+	Version         string            `xml:"version,attr"`
+	TitleInfo       *modsTitleInfo    `xml:"titleInfo,omitempty"`
+	Names           []modsName        `xml:"name"`
+	TypeOfResource  string            `xml:"typeOfResource,omitempty"`
+	Genre           string            `xml:"genre,omitempty"`
+	OriginInfo      *modsOriginInfo   `xml:"originInfo,omitempty"`
+	Languages       []modsLanguage    `xml:"language"`
+	Abstract        string            `xml:"abstract,omitempty"`
+	Notes           []string          `xml:"note"`
+	Subjects        []modsSubject     `xml:"subject"`
+	RelatedItems    []modsRelatedItem `xml:"relatedItem"`
+	Identifiers     []modsTypedText   `xml:"identifier"`
+	Location        *modsLocation     `xml:"location,omitempty"`
+	AccessCondition *modsTypedText    `xml:"accessCondition,omitempty"`
+}
+
+type modsEncoder struct {
+	cfg    serviceConfigFormat
+	url    string
+	record modsRecord
+	policy *bluemonday.Policy
+}
+
+var modsResourceTypesMap map[string]string
+
+func newModsEncoder(cfg serviceConfigFormat) *modsEncoder {
+	e := modsEncoder{}
+
+	e.cfg = cfg
+	e.policy = bluemonday.StrictPolicy()
+
+	return &e
+}
+
+func (e *modsEncoder) Init(c *clientContext, url string) {
+	e.url = url
+}
+
+func (e *modsEncoder) Populate(parts citationParts) error {
+	data, err := newRawCitation(e.url, parts)
+	if err != nil {
+		return err
+	}
+
+	rec := modsRecord{
+		Namespace:      modsNamespace,
+		XSINamespace:   "http://www.w3.org/2001/XMLSchema-instance",
+		SchemaLocation: modsSchemaLocation,
+		Version:        modsVersion,
+	}
+
+	// MODS keeps subtitles separate
+	title := e.cleanString(removeTrailingPeriods(firstElementOf(parts["title"])))
+	if title != "" {
+		rec.TitleInfo = &modsTitleInfo{
+			Title:    title,
+			SubTitle: e.cleanString(removeTrailingPeriods(firstElementOf(parts["subtitle"]))),
+		}
+	}
+
+	e.addNames(&rec, data.authors, modsRelatorAuthor)
+	e.addNames(&rec, data.editors, modsRelatorEditor)
+	e.addNames(&rec, data.advisors, modsRelatorAdvisor)
+	e.addNames(&rec, data.translators, modsRelatorTranslator)
+	e.addNames(&rec, data.compilers, modsRelatorCompiler)
+
+	rec.TypeOfResource = modsResourceMixed
+	if resourceType, ok := modsResourceTypesMap[data.format]; ok == true {
+		rec.TypeOfResource = resourceType
+	}
+
+	rec.Genre = e.cleanString(firstElementOf(parts["genre"]))
+
+	origin := modsOriginInfo{
+		Publisher: e.cleanString(data.publisher),
+		Edition:   e.cleanString(cleanEndPunctuation(firstElementOf(parts["edition"]))),
+	}
+
+	if place := e.cleanString(cleanEndPunctuation(firstElementOf(parts["published_location"]))); place != "" {
+		origin.Place = &modsPlace{PlaceTerm: modsTypedText{Type: "text", Value: place}}
+	}
+
+	if data.year != 0 {
+		origin.DateIssued = &modsDate{Encoding: "w3cdtf", KeyDate: "yes", Value: isoDate(data.year, data.month, data.day)}
+	}
+
+	if origin != (modsOriginInfo{}) {
+		rec.OriginInfo = &origin
+	}
+
+	for _, language := range e.cleanStrings(parts["language"]) {
+		rec.Languages = append(rec.Languages, modsLanguage{LanguageTerm: modsTypedText{Type: "text", Value: language}})
+	}
+
+	rec.Abstract = e.cleanString(strings.Join(parts["abstract"], " "))
+	rec.Notes = e.cleanStrings(parts["description"])
+
+	for _, subject := range e.cleanStrings(parts["subject"]) {
+		rec.Subjects = append(rec.Subjects, modsSubject{Topic: subject})
+	}
+
+	// journal articles (and the like) are described as parts of their host
+	part := modsPart{}
+
+	if data.volume != "" {
+		part.Details = append(part.Details, modsDetail{Type: "volume", Number: e.cleanString(data.volume)})
+	}
+
+	if data.issue != "" {
+		part.Details = append(part.Details, modsDetail{Type: "issue", Number: e.cleanString(data.issue)})
+	}
+
+	if data.pageFrom != "" {
+		part.Extent = &modsExtent{Unit: "pages", Start: data.pageFrom, End: data.pageTo}
+	}
+
+	if journal := e.cleanString(data.journal); journal != "" {
+		host := modsRelatedItem{Type: "host", TitleInfo: modsTitleInfo{Title: journal}}
+
+		if len(part.Details) > 0 || part.Extent != nil {
+			host.Part = &part
+		}
+
+		rec.RelatedItems = append(rec.RelatedItems, host)
+	}
+
+	if series := e.cleanString(firstElementOf(parts["series"])); series != "" {
+		rec.RelatedItems = append(rec.RelatedItems, modsRelatedItem{Type: "series", TitleInfo: modsTitleInfo{Title: series}})
+	}
+
+	if doi := re.doiPrefix.ReplaceAllString(e.cleanString(firstElementOf(parts["doi"])), ""); doi != "" {
+		rec.Identifiers = append(rec.Identifiers, modsTypedText{Type: "doi", Value: doi})
+	}
+
+	serialType := serialNumberKind(data.format)
+
+	for _, serialNumber := range e.cleanStrings(parts["serial_number"]) {
+		rec.Identifiers = append(rec.Identifiers, modsTypedText{Type: serialType, Value: serialNumber})
+	}
+
+	location := modsLocation{ShelfLocator: e.cleanString(strings.Join(parts["call_number"], "; "))}
+
+	for _, url := range e.cleanStrings(parts["url"]) {
+		location.URLs = append(location.URLs, modsURL{Usage: "primary display", Value: url})
+	}
+
+	for _, url := range e.cleanStrings(parts["full_text_url"]) {
+		location.URLs = append(location.URLs, modsURL{Access: "raw object", Value: url})
+	}
+
+	if e.url != "" {
+		location.URLs = append(location.URLs, modsURL{Access: "object in context", Value: e.url})
+	}
+
+	if location.ShelfLocator != "" || len(location.URLs) > 0 {
+		rec.Location = &location
+	}
+
+	if rights := e.cleanString(strings.Join(parts["rights"], " ")); rights != "" {
+		rec.AccessCondition = &modsTypedText{Type: "use and reproduction", Value: rights}
+	}
+
+	e.record = rec
+
+	return nil
+}
+
+func (e *modsEncoder) addNames(rec *modsRecord, names []string, relator modsRelator) {
+	for _, name := range e.cleanStrings(names) {
+		n := splitName(name)
+
+		if n.family == "" {
+			continue
+		}
+
+		mn := modsName{
+			DisplayForm: name,
+			Role: modsRole{RoleTerms: []modsTypedText{
+				{Type: "text", Authority: "marcrelator", Value: relator.term},
+				{Type: "code", Authority: "marcrelator", Value: relator.code},
+			}},
+		}
+
+		if n.corporate == true {
+			mn.Type = "corporate"
+			mn.NameParts = []modsTypedText{{Value: n.family}}
+		} else {
+			mn.Type = "personal"
+			mn.NameParts = []modsTypedText{{Type: "family", Value: n.family}}
+
+			if n.given != "" {
+				mn.NameParts = append(mn.NameParts, modsTypedText{Type: "given", Value: n.given})
+			}
+
+			if n.suffix != "" {
+				mn.NameParts = append(mn.NameParts, modsTypedText{Type: "termsOfAddress", Value: n.suffix})
+			}
+		}
+
+		rec.Names = append(rec.Names, mn)
+	}
+}
+
+func (e *modsEncoder) cleanString(val string) string {
+	return plainText(e.policy, val)
+}
+
+func (e *modsEncoder) cleanStrings(vals []string) []string {
+	var cleaned []string
+
+	for _, val := range vals {
+		if c := e.cleanString(val); c != "" {
+			cleaned = append(cleaned, c)
+		}
+	}
+
+	return cleaned
+}
+
+func (e *modsEncoder) Label() string {
+	return e.cfg.Label
+}
+
+func (e *modsEncoder) ContentType() string {
+	return e.cfg.ContentType
+}
+
+func (e *modsEncoder) FileName() string {
+	filename := itemName(e.url)
+
+	if e.cfg.Extension != "" {
+		filename += "." + e.cfg.Extension
+	}
+
+	return filename
+}
+
+func (e *modsEncoder) Contents() (string, error) {
+	data, err := xml.MarshalIndent(e.record, "", "  ")
+	if err != nil {
+		return "", err
+	}
+
+	return xml.Header + string(data) + "\n", nil
+}
+
+func init() {
+	// mapping of citation formats (citation part "format") to MODS resource type
+	modsResourceTypesMap = make(map[string]string)
+
+	modsResourceTypesMap["art"] = modsResourceStillImage
+	modsResourceTypesMap["article"] = modsResourceText
+	modsResourceTypesMap["book"] = modsResourceText
+	modsResourceTypesMap["government_document"] = modsResourceText
+	modsResourceTypesMap["journal"] = modsResourceText
+	modsResourceTypesMap["manuscript"] = modsResourceText
+	modsResourceTypesMap["map"] = modsResourceCartographic
+	modsResourceTypesMap["music"] = modsResourceNotatedMusic
+	modsResourceTypesMap["news"] = modsResourceText
+	modsResourceTypesMap["sound"] = modsResourceSoundRecording
+	modsResourceTypesMap["thesis"] = modsResourceText
+	modsResourceTypesMap["video"] = modsResourceMovingImage
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// formatted citations, as with doi content negotiation
+const bibliographyType = "text/x-bibliography"
+
+// the style used for formatted citations when none is requested
+const defaultBibliographyStyle = "apa"
+
+// styles that can be requested as formatted citations, other than csl styles
+var bibliographyStyles = []string{"apa", "cms", "lbb", "mla"}
+
+// styles that can be requested by their configured content type, in order of preference for wildcard requests
+var negotiableStyles = []string{"ris", "bibtex", "biblatex", "csl-json", "enw", "endnote", "mods", "jsonld"}
+
+// a media type (plus style, for formatted citations) that /citation can produce
+type negotiableType struct {
+	mediaType string
+	style     string
+	encoder   func(p *serviceContext, c *gin.Context) (citationType, error)
+}
+
+// a single media range from an Accept header
+type acceptRange struct {
+	mediaType string
+	style     string
+	q         float64
+}
+
+// a citation served under the negotiated content type rather than its configured one
+type negotiatedCitation struct {
+	citationType
+	contentType string
+}
+
+func (n negotiatedCitation) ContentType() string {
+	return n.contentType
+}
+
+func (t negotiableType) String() string {
+	if t.style != "" {
+		return fmt.Sprintf("%s; style=%s", t.mediaType, t.style)
+	}
+
+	return t.mediaType
+}
+
+func (p *serviceContext) initNegotiation() {
+	seen := make(map[string]bool)
+
+	add := func(mediaType, style string, encoder func(p *serviceContext, c *gin.Context) (citationType, error)) {
+		key := mediaType + " " + style
+		if seen[key] == true {
+			log.Printf("[NEGOTIATION] WARNING: ignoring duplicate type %s", key)
+			return
+		}
+
+		seen[key] = true
+		p.negotiation = append(p.negotiation, negotiableType{mediaType: mediaType, style: style, encoder: encoder})
+	}
+
+	// formatted citations come first, so that they are what wildcard requests get
+
+	for _, name := range bibliographyStyles {
+		add(bibliographyType, name, citationStyles[name].encoder)
+	}
+
+	var ids []string
+	for id := range p.csl.styles {
+		ids = append(ids, id)
+	}
+
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		style := p.csl.styles[id]
+		add(bibliographyType, id, func(p *serviceContext, c *gin.Context) (citationType, error) {
+			return newCSLEncoder(p.config.Formats.CSL, style, true), nil
+		})
+	}
+
+	// file formats, by their configured content types
+
+	addFormat := func(contentType string, encoder func(p *serviceContext, c *gin.Context) (citationType, error)) {
+		if contentType == "" {
+			return
+		}
+
+		mediaType, _, err := mime.ParseMediaType(contentType)
+		if err != nil {
+			log.Printf("[NEGOTIATION] WARNING: ignoring invalid content type [%s]: %s", contentType, err.Error())
+			return
+		}
+
+		add(mediaType, "", encoder)
+	}
+
+	for _, name := range negotiableStyles {
+		// these styles do not depend on the request
+		citation, _ := citationStyles[name].encoder(p, nil)
+		addFormat(citation.ContentType(), citationStyles[name].encoder)
+	}
+
+	// dublin core is a single style with two content types
+
+	addFormat(p.config.Formats.DC.ContentType, func(p *serviceContext, c *gin.Context) (citationType, error) {
+		return newDcEncoder(p.config.Formats.DC, false), nil
+	})
+
+	addFormat(p.config.Formats.DCJSON.ContentType, func(p *serviceContext, c *gin.Context) (citationType, error) {
+		return newDcEncoder(p.config.Formats.DCJSON, true), nil
+	})
+
+	log.Printf("[NEGOTIATION] %d citation type(s) available", len(p.negotiation))
+}
+
+func parseAccept(header string) []acceptRange {
+	var ranges []acceptRange
+
+	// no Accept header means anything is acceptable
+	if strings.TrimSpace(header) == "" {
+		header = "*/*"
+	}
+
+	for _, part := range strings.Split(header, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+
+		r := acceptRange{mediaType: mediaType, style: params["style"], q: 1}
+
+		if qStr, ok := params["q"]; ok == true {
+			if q, qErr := strconv.ParseFloat(qStr, 64); qErr == nil {
+				r.q = q
+			}
+		}
+
+		// explicitly unacceptable
+		if r.q <= 0 {
+			continue
+		}
+
+		ranges = append(ranges, r)
+	}
+
+	// most preferred first; for equal preference, specific types win over wildcards
+	sort.SliceStable(ranges, func(i, j int) bool {
+		if ranges[i].q != ranges[j].q {
+			return ranges[i].q > ranges[j].q
+		}
+
+		return strings.Count(ranges[i].mediaType, "*") < strings.Count(ranges[j].mediaType, "*")
+	})
+
+	return ranges
+}
+
+func (r acceptRange) matches(t negotiableType) bool {
+	switch {
+	case r.mediaType == "*/*":
+		return t.style == "" || t.style == defaultBibliographyStyle
+
+	case strings.HasSuffix(r.mediaType, "/*"):
+		if strings.HasPrefix(t.mediaType, strings.TrimSuffix(r.mediaType, "*")) == false {
+			return false
+		}
+
+		return t.style == "" || t.style == defaultBibliographyStyle
+
+	case r.mediaType != t.mediaType:
+		return false
+	}
+
+	// formatted citations in the default style, unless another style is requested
+	if t.mediaType == bibliographyType {
+		style := r.style
+		if style == "" {
+			style = defaultBibliographyStyle
+		}
+
+		return style == t.style
+	}
+
+	return true
+}
+
+func (p *serviceContext) negotiateType(header string) (negotiableType, bool) {
+	for _, r := range parseAccept(header) {
+		for _, t := range p.negotiation {
+			if r.matches(t) == true {
+				return t, true
+			}
+		}
+	}
+
+	return negotiableType{}, false
+}
+
+func (p *serviceContext) negotiationHandler(c *gin.Context) {
+	cl := clientContext{}
+	cl.init(p, c)
+
+	// responses differ by Accept header, so caches need to know
+	c.Header("Vary", "Accept")
+
+	t, ok := p.negotiateType(c.GetHeader("Accept"))
+	if ok == false {
+		var types []string
+		for _, t := range p.negotiation {
+			types = append(types, t.String())
+		}
+
+		cl.logRequest()
+		p.requestError(&cl, http.StatusNotAcceptable, fmt.Errorf("no acceptable citation type; supported types: %s", strings.Join(types, ", ")))
+		return
+	}
+
+	citation, err := t.encoder(p, c)
+	if err != nil {
+		cl.logRequest()
+		p.requestError(&cl, http.StatusBadRequest, err)
+		return
+	}
+
+	// the negotiated type is the response itself, rather than a download
+	cl.opts.inline = true
+
+	contentType := citation.ContentType()
+
+	// formatted citations are plain text
+	if t.mediaType == bibliographyType {
+		cl.opts.nohtml = true
+		contentType = bibliographyType + "; charset=utf-8"
+	}
+
+	p.citationHandler(&cl, false, []citationType{negotiatedCitation{citationType: citation, contentType: contentType}})
+}
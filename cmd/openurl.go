@@ -0,0 +1,252 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"net/url"
+	"strings"
+
+	"github.com/microcosm-cc/bluemonday"
+)
+
+// OpenURL 1.0 (Z39.88-2004) KEV definitions
+const openurlVersion = "Z39.88-2004"
+const openurlEncoding = "info:ofi/enc:UTF-8"
+const openurlFormatBook = "info:ofi/fmt:kev:mtx:book"
+const openurlFormatJournal = "info:ofi/fmt:kev:mtx:journal"
+
+// a key/value pair; order is preserved, and keys may repeat
+type openurlPair struct {
+	key   string
+	value string
+}
+
+type openurlContextObject []openurlPair
+
+// generates the OpenURL query string, optionally appended to a link resolver base url
+type openurlEncoder struct {
+	cfg      serviceConfigFormat
+	url      string
+	resolver string
+	referrer string
+	kev      string
+}
+
+// generates a COinS span containing the OpenURL query string
+type coinsEncoder struct {
+	cfg      serviceConfigFormat
+	url      string
+	referrer string
+	kev      string
+}
+
+var openurlBookGenresMap map[string]string
+
+func (o *openurlContextObject) add(key, value string) {
+	if value == "" {
+		return
+	}
+
+	*o = append(*o, openurlPair{key: key, value: value})
+}
+
+func (o openurlContextObject) encode() string {
+	var pairs []string
+
+	for _, pair := range o {
+		pairs = append(pairs, url.QueryEscape(pair.key)+"="+url.QueryEscape(pair.value))
+	}
+
+	return strings.Join(pairs, "&")
+}
+
+func newOpenURLContextObject(v4url, referrer string, parts citationParts) (openurlContextObject, error) {
+	data, err := newRawCitation(v4url, parts)
+	if err != nil {
+		return nil, err
+	}
+
+	policy := bluemonday.StrictPolicy()
+
+	clean := func(s string) string {
+		return plainText(policy, s)
+	}
+
+	co := openurlContextObject{}
+
+	co.add("ctx_ver", openurlVersion)
+	co.add("ctx_enc", openurlEncoding)
+	co.add("rfr_id", referrer)
+
+	co.add("rft_id", v4url)
+	if doi := re.doiPrefix.ReplaceAllString(clean(firstElementOf(parts["doi"])), ""); doi != "" {
+		co.add("rft_id", "info:doi/"+doi)
+	}
+
+	title := clean(data.title)
+	serialNumber := clean(firstElementOf(parts["serial_number"]))
+
+	switch {
+	case data.isArticle == true:
+		co.add("rft_val_fmt", openurlFormatJournal)
+		co.add("rft.genre", "article")
+		co.add("rft.atitle", title)
+		co.add("rft.jtitle", clean(data.journal))
+		co.add("rft.volume", clean(data.volume))
+		co.add("rft.issue", clean(data.issue))
+		co.add("rft.spage", data.pageFrom)
+		co.add("rft.epage", data.pageTo)
+		co.add("rft.issn", serialNumber)
+
+	case data.format == "journal":
+		co.add("rft_val_fmt", openurlFormatJournal)
+		co.add("rft.genre", "journal")
+		co.add("rft.jtitle", title)
+		co.add("rft.issn", serialNumber)
+
+	default:
+		genre := openurlBookGenresMap[data.format]
+		if genre == "" {
+			genre = "document"
+		}
+
+		co.add("rft_val_fmt", openurlFormatBook)
+		co.add("rft.genre", genre)
+		co.add("rft.btitle", title)
+		co.add("rft.series", clean(firstElementOf(parts["series"])))
+		co.add("rft.edition", clean(cleanEndPunctuation(firstElementOf(parts["edition"]))))
+		co.add("rft.place", clean(cleanEndPunctuation(firstElementOf(parts["published_location"]))))
+		co.add("rft.pub", clean(data.publisher))
+		co.add("rft.isbn", serialNumber)
+	}
+
+	if data.year != 0 {
+		co.add("rft.date", isoDate(data.year, data.month, data.day))
+	}
+
+	// first author is broken out into its parts; all authors are listed in full
+	authors := []string{}
+	for _, author := range data.authors {
+		if a := clean(author); a != "" {
+			authors = append(authors, a)
+		}
+	}
+
+	if len(authors) > 0 {
+		n := splitName(authors[0])
+
+		if n.corporate == true {
+			co.add("rft.aucorp", n.family)
+		} else {
+			co.add("rft.aulast", n.family)
+			co.add("rft.aufirst", n.given)
+			co.add("rft.ausuffix", n.suffix)
+		}
+	}
+
+	for _, author := range authors {
+		co.add("rft.au", author)
+	}
+
+	co.add("rft.language", clean(firstElementOf(parts["language"])))
+
+	return co, nil
+}
+
+func newOpenURLEncoder(cfg serviceConfigFormat, resolver, referrer string) *openurlEncoder {
+	e := openurlEncoder{}
+
+	e.cfg = cfg
+	e.resolver = resolver
+	e.referrer = referrer
+
+	return &e
+}
+
+func (e *openurlEncoder) Init(c *clientContext, url string) {
+	e.url = url
+}
+
+func (e *openurlEncoder) Populate(parts citationParts) error {
+	co, err := newOpenURLContextObject(e.url, e.referrer, parts)
+	if err != nil {
+		return err
+	}
+
+	e.kev = co.encode()
+
+	return nil
+}
+
+func (e *openurlEncoder) Label() string {
+	return e.cfg.Label
+}
+
+func (e *openurlEncoder) ContentType() string {
+	return e.cfg.ContentType
+}
+
+func (e *openurlEncoder) FileName() string {
+	return ""
+}
+
+func (e *openurlEncoder) Contents() (string, error) {
+	if e.resolver == "" {
+		return e.kev, nil
+	}
+
+	separator := "?"
+	if strings.Contains(e.resolver, "?") == true {
+		separator = "&"
+	}
+
+	return e.resolver + separator + e.kev, nil
+}
+
+func newCoinsEncoder(cfg serviceConfigFormat, referrer string) *coinsEncoder {
+	e := coinsEncoder{}
+
+	e.cfg = cfg
+	e.referrer = referrer
+
+	return &e
+}
+
+func (e *coinsEncoder) Init(c *clientContext, url string) {
+	e.url = url
+}
+
+func (e *coinsEncoder) Populate(parts citationParts) error {
+	co, err := newOpenURLContextObject(e.url, e.referrer, parts)
+	if err != nil {
+		return err
+	}
+
+	e.kev = co.encode()
+
+	return nil
+}
+
+func (e *coinsEncoder) Label() string {
+	return e.cfg.Label
+}
+
+func (e *coinsEncoder) ContentType() string {
+	return e.cfg.ContentType
+}
+
+func (e *coinsEncoder) FileName() string {
+	return ""
+}
+
+func (e *coinsEncoder) Contents() (string, error) {
+	return fmt.Sprintf(`<span class="Z3988" title="%s"></span>`, html.EscapeString(e.kev)), nil
+}
+
+func init() {
+	// mapping of citation formats (citation part "format") to OpenURL book genre
+	openurlBookGenresMap = make(map[string]string)
+
+	openurlBookGenresMap["book"] = "book"
+	openurlBookGenresMap["government_document"] = "report"
+}
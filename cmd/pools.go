@@ -1,42 +1,212 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
-	"strings"
+	"net/url"
+	"strconv"
+	"syscall"
 	"time"
 
 	"github.com/uvalib/virgo4-api/v4api"
 	"github.com/uvalib/virgo4-jwt/v4jwt"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// how a single pool record request went, as far as retries and the circuit breaker are concerned
+type poolAttempt int
+
+const (
+	poolResponded   poolAttempt = iota // the pool responded, even if not with a usable record
+	poolRetryable                      // a transient failure, worth retrying
+	poolUnreachable                    // the pool could not be reached, and retrying will not help
+	poolRejected                       // the allowlist refused the request, which says nothing about the pool
+)
+
+// the outcome of a pool record request, as shared among concurrent callers
+type poolRecordResult struct {
+	rec  *v4api.Record
+	resp serviceResponse
+}
+
+func (s *citationsContext) poolClaims() v4jwt.V4Claims {
+	if s.client.claims != nil {
+		return *s.client.claims
+	}
+
+	return s.svc.auth.claims
+}
+
+// the name the circuit breaker knows an item's pool by: its registry id, or else the
+// allowlist entry its url matched.  unlike host names, these are bounded by configuration.
+func (s *citationsContext) poolKey() string {
+	if s.pool != nil {
+		return s.pool.id
+	}
+
+	if u, err := url.Parse(s.url); err == nil {
+		if entry := s.svc.pools.allowlist.match(u); entry != nil {
+			return entry.pattern
+		}
+	}
+
+	return "other"
+}
+
+// the pool metrics label: the registry id, since anything else (e.g. hosts) can be
+// made up by whoever supplies the item url
+func (s *citationsContext) poolLabel() string {
+	if s.pool != nil {
+		return s.pool.id
+	}
+
+	return "other"
+}
+
+func (s *citationsContext) poolRecordKey() string {
+	// pools may return different records for different callers, so
+	// records are only shared among callers with identical claims
+	claims, _ := json.Marshal(s.poolClaims())
+
+	return s.url + " " + string(claims)
+}
+
+func (s *citationsContext) sharedPoolRecord() (*v4api.Record, serviceResponse) {
+	// concurrent requests for the same item share a single in-flight pool request.
+	// the result always carries its own serviceResponse, so each caller gets the
+	// same status and error that the request that actually hit the pool got.
+
+	val, _, shared := s.svc.pools.inflight.Do(s.poolRecordKey(), func() (interface{}, error) {
+		rec, resp := s.queryPoolRecord()
+		return poolRecordResult{rec: rec, resp: resp}, nil
+	})
+
+	res := val.(poolRecordResult)
+
+	if shared == true {
+		s.log("[POOL] shared in-flight request for %s", s.url)
+	}
+
+	return res.rec, res.resp
+}
+
 func (s *citationsContext) queryPoolRecord() (*v4api.Record, serviceResponse) {
+	ctx, span := s.startSpan("queryPoolRecord", trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		attribute.String("citation.item", s.url),
+	))
+
+	// the request may be shared with other callers, so it must not fail just because
+	// this caller went away; it keeps the trace, and the pools client timeout still applies
+	rec, resp := s.fetchPoolRecord(context.WithoutCancel(ctx))
+
+	endSpan(span, resp.status, resp.err)
+
+	return rec, resp
+}
+
+func (s *citationsContext) fetchPoolRecord(ctx context.Context) (*v4api.Record, serviceResponse) {
+	req, resp := s.poolRecordRequest(ctx)
+	if resp.err != nil {
+		return nil, resp
+	}
+
+	// fail fast while the pool is known to be down
+
+	host := req.URL.Host
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(attribute.String("server.address", host))
+	breaker := s.svc.pools.breaker
+	key := s.poolKey()
+
+	if breaker.allow(key) == false {
+		s.warn("[POOL] circuit breaker open for pool %s; not requesting %s", key, s.url)
+		metrics.poolRequestSkipped(s.poolLabel(), "circuit_open")
+		return nil, serviceResponse{status: http.StatusServiceUnavailable, err: errPoolUnavailable}
+	}
+
+	retries := s.svc.pools.retries
+
+	for attempt := 0; ; attempt++ {
+		rec, resp, outcome, result := s.attemptPoolRecord(req)
+		metrics.poolRequest(s.poolLabel(), result, s.poolLatency)
+
+		if outcome == poolResponded {
+			breaker.success(key)
+			return rec, resp
+		}
+
+		if outcome == poolRejected {
+			breaker.release(key)
+			return rec, resp
+		}
+
+		// only a pool that actually responded counts as being up
+		if outcome == poolUnreachable || attempt >= retries {
+			if breaker.failure(key) == true {
+				s.err("[POOL] circuit breaker opened for pool %s", key)
+			}
+
+			return rec, resp
+		}
+
+		delay := s.svc.pools.backoff(attempt)
+		span.AddEvent("retry", trace.WithAttributes(attribute.Int("retry.attempt", attempt+1), attribute.Int64("retry.delay_ms", delay.Milliseconds())))
+		s.log("[POOL] retrying %s in %d ms (retry %d of %d)", s.url, int64(delay/time.Millisecond), attempt+1, retries)
+
+		// not cut short when the caller goes away: the request may be shared (see queryPoolRecord),
+		// and every attempt must end with a breaker outcome, or a half-open breaker would never close
+		time.Sleep(delay)
+	}
+}
+
+// checks the item url and prepares an authorized request for its pool record
+func (s *citationsContext) poolRecordRequest(ctx context.Context) (*http.Request, serviceResponse) {
 	var err error
 
 	if s.url == "" {
 		err = fmt.Errorf("missing or invalid url")
-		s.warn(err.Error())
+		s.warn("%s", err.Error())
+		return nil, serviceResponse{status: http.StatusBadRequest, err: err}
+	}
+
+	// only request items from allowed pools, before handing out a token
+
+	if urlErr := s.svc.pools.allowlist.check(s.url); urlErr != nil {
+		err = fmt.Errorf("invalid item url: %s", urlErr.Error())
+		s.warn("[POOL] %s: %s", err.Error(), s.url)
 		return nil, serviceResponse{status: http.StatusBadRequest, err: err}
 	}
 
-	// create a short-lived single-use token, (ab)using IsUVA claim to make
-	// sure we get all possible info from the pool.
+	// and only from pools the registry knows about, if there is one
+
+	if resp := s.checkPoolRegistry(); resp.err != nil {
+		s.warn("[POOL] %s: %s", resp.err.Error(), s.url)
+		return nil, resp
+	}
+
+	if s.pool != nil {
+		s.log("[POOL] item belongs to pool %s (%s)", s.pool.id, s.pool.name)
+	}
 
-	// there is a risk that anyone can access protected resources through
-	// this service, but that is limited to the citation info exposed by each pool.
+	// create a short-lived single-use token on behalf of the caller, so that
+	// the pool only exposes what the caller would otherwise be able to see.
 
-	claims := v4jwt.V4Claims{IsUVA: true}
+	claims := s.poolClaims()
 
 	token, jwtErr := v4jwt.Mint(claims, time.Duration(s.svc.config.JWT.Expiration)*time.Minute, s.svc.config.JWT.Key)
 	if jwtErr != nil {
 		err = fmt.Errorf("failed to mint JWT: %s", jwtErr.Error())
-		s.err(err.Error())
-		return nil, serviceResponse{status: http.StatusBadRequest, err: err}
+		s.err("%s", err.Error())
+		return nil, serviceResponse{status: http.StatusInternalServerError, err: err}
 	}
 
 	// the citation query parameter is only used by the solr pool, and is not relevant to other pools
-	req, reqErr := http.NewRequest("GET", s.url+"?citation=1", nil)
+	req, reqErr := http.NewRequestWithContext(ctx, "GET", s.url+"?citation=1", nil)
 	if reqErr != nil {
 		s.log("[POOL] NewRequest() failed: %s", reqErr.Error())
 		err = fmt.Errorf("failed to create pool record request")
@@ -44,63 +214,106 @@ func (s *citationsContext) queryPoolRecord() (*v4api.Record, serviceResponse) {
 	}
 
 	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+	req.Header.Set(requestIDHeader, s.client.reqID)
+	injectTrace(ctx, req)
+
+	return req, serviceResponse{status: http.StatusOK}
+}
+
+// makes a single pool record request, and reports how it went (including the
+// result for metrics, which are left to the caller)
+func (s *citationsContext) attemptPoolRecord(req *http.Request) (*v4api.Record, serviceResponse, poolAttempt, string) {
+	var err error
 
 	start := time.Now()
 	res, resErr := s.svc.pools.client.Do(req)
-	elapsedMS := int64(time.Since(start) / time.Millisecond)
+	elapsed := time.Since(start)
+	elapsedMS := int64(elapsed / time.Millisecond)
+
+	s.poolLatency = elapsed
 
 	// external service failure logging
 
 	if resErr != nil {
-		status := http.StatusBadRequest
+		resp := serviceResponse{status: http.StatusBadGateway, err: errPoolUnavailable}
 		errMsg := resErr.Error()
-		if strings.Contains(errMsg, "Timeout") {
-			status = http.StatusRequestTimeout
+		outcome := poolUnreachable
+		result := "error"
+
+		var policyErr poolPolicyError
+		if errors.As(resErr, &policyErr) == true {
+			resp = serviceResponse{status: http.StatusBadRequest, err: fmt.Errorf("invalid item url: %s", policyErr.Error())}
+			errMsg = policyErr.Error()
+			outcome = poolRejected
+			result = "not_allowed"
+		} else if isTimeoutError(resErr) == true {
+			resp = serviceResponse{status: http.StatusGatewayTimeout, err: errPoolTimeout}
 			errMsg = fmt.Sprintf("%s timed out", s.url)
-		} else if strings.Contains(errMsg, "connection refused") {
-			status = http.StatusServiceUnavailable
+			outcome = poolRetryable
+			result = "timeout"
+		} else if errors.Is(resErr, syscall.ECONNREFUSED) == true {
 			errMsg = fmt.Sprintf("%s refused connection", s.url)
+			outcome = poolRetryable
+			result = "refused"
 		}
 
 		s.log("[POOL] client.Do() failed: %s", resErr.Error())
-		s.err("Failed response from %s %s - %d:%s. Elapsed Time: %d (ms)", req.Method, s.url, status, errMsg, elapsedMS)
-		err = fmt.Errorf("failed to receive pool record response")
-		return nil, serviceResponse{status: http.StatusInternalServerError, err: err}
+		s.err("Failed response from %s %s - %d:%s. Elapsed Time: %d (ms)", req.Method, s.url, resp.status, errMsg, elapsedMS)
+
+		return nil, resp, outcome, result
 	}
 
 	defer res.Body.Close()
 
 	if res.StatusCode != http.StatusOK {
-		errMsg := fmt.Errorf("unexpected status code %d", res.StatusCode)
+		resp := s.poolErrorResponse(res.StatusCode)
+		errMsg := fmt.Errorf("unexpected pool status code %d", res.StatusCode)
 		s.log("[POOL] unexpected status code %d", res.StatusCode)
 
-		// 404 errors from the pool are likely old bookmarked items that have since become shadowed, or no longer exist
-		if res.StatusCode == http.StatusNotFound {
-			s.warn("Failed response from %s %s - %d:%s. Elapsed Time: %d (ms)", req.Method, s.url, res.StatusCode, errMsg, elapsedMS)
+		// items that no longer exist are not a problem with the pool
+		if res.StatusCode == http.StatusNotFound || res.StatusCode == http.StatusGone {
+			s.warn("Failed response from %s %s - %d:%s. Elapsed Time: %d (ms)", req.Method, s.url, resp.status, errMsg, elapsedMS)
 		} else {
-			s.err("Failed response from %s %s - %d:%s. Elapsed Time: %d (ms)", req.Method, s.url, res.StatusCode, errMsg, elapsedMS)
+			s.err("Failed response from %s %s - %d:%s. Elapsed Time: %d (ms)", req.Method, s.url, resp.status, errMsg, elapsedMS)
 		}
 
-		err = fmt.Errorf("received pool record response code %d", res.StatusCode)
-		return nil, serviceResponse{status: http.StatusInternalServerError, err: err}
+		// gateway errors are usually transient
+		outcome := poolResponded
+		switch res.StatusCode {
+		case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			outcome = poolRetryable
+		}
+
+		return nil, resp, outcome, strconv.Itoa(res.StatusCode)
 	}
 
 	var rec v4api.Record
 
 	decoder := json.NewDecoder(res.Body)
 
+	_, span := tracer.Start(req.Context(), "decodePoolRecord")
+	decErr := decoder.Decode(&rec)
+	endSpan(span, 0, decErr)
+
 	// external service failure logging (scenario 2)
 
-	if decErr := decoder.Decode(&rec); decErr != nil {
+	if decErr != nil {
 		s.log("[POOL] Decode() failed: %s", decErr.Error())
-		s.err("Failed response from %s %s - %d:%s. Elapsed Time: %d (ms)", req.Method, s.url, http.StatusInternalServerError, decErr.Error(), elapsedMS)
 		err = fmt.Errorf("failed to decode pool record response")
-		return nil, serviceResponse{status: http.StatusInternalServerError, err: err}
+		resp := serviceResponse{status: http.StatusBadGateway, code: errorBadRecord, err: err}
+		s.err("Failed response from %s %s - %d:%s. Elapsed Time: %d (ms)", req.Method, s.url, resp.status, decErr.Error(), elapsedMS)
+		return nil, resp, poolResponded, "invalid"
 	}
 
 	// external service success logging
 
 	s.log("Successful pool record response from %s %s. Elapsed Time: %d (ms)", req.Method, s.url, elapsedMS)
 
-	return &rec, serviceResponse{status: http.StatusOK}
+	return &rec, serviceResponse{status: http.StatusOK}, poolResponded, "ok"
+}
+
+func isTimeoutError(err error) bool {
+	var netErr net.Error
+
+	return errors.As(err, &netErr) == true && netErr.Timeout() == true
 }
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/uvalib/virgo4-api/v4api"
+)
+
+// upper limit on the size of a posted record
+const recordMaxBytes = 1 << 20
+
+func (p *serviceContext) recordHandler(c *gin.Context) {
+	cl := clientContext{}
+	cl.init(p, c)
+
+	cl.logRequest()
+
+	name := c.Param("style")
+
+	style, ok := citationStyles[name]
+	if ok == false {
+		p.requestError(&cl, http.StatusBadRequest, fmt.Errorf("unknown citation style: [%s]", name))
+		return
+	}
+
+	body, readErr := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, recordMaxBytes))
+	if readErr != nil {
+		p.requestError(&cl, http.StatusBadRequest, fmt.Errorf("failed to read record: %s", readErr.Error()))
+		return
+	}
+
+	parts, partsErr := citationPartsFromBody(body)
+	if partsErr != nil {
+		p.requestError(&cl, http.StatusBadRequest, partsErr)
+		return
+	}
+
+	citation, encErr := style.encoder(p, c)
+	if encErr != nil {
+		p.requestError(&cl, http.StatusBadRequest, encErr)
+		return
+	}
+
+	cl.styles = []string{citation.Label()}
+
+	// the item url is optional here; fall back to the record's own identifier, if any
+	s := citationsContext{}
+	s.init(p, &cl)
+
+	if s.url == "" {
+		s.initWithURL(p, &cl, firstElementOf(parts["id"]))
+	}
+
+	// the posted record stands in for the pool record
+	s.parts = parts
+	s.initialized = true
+
+	s.serveCitations(style.json, []citationType{citation})
+}
+
+func citationPartsFromBody(body []byte) (citationParts, error) {
+	// accepts either a v4 record (as returned by a pool), or a map of citation parts
+	// to values, where each value is either a string or a list of strings
+
+	var raw map[string]json.RawMessage
+
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return nil, fmt.Errorf("invalid record: %s", err.Error())
+	}
+
+	var parts citationParts
+
+	if _, ok := raw["fields"]; ok == true {
+		var rec v4api.Record
+
+		if err := json.Unmarshal(body, &rec); err != nil {
+			return nil, fmt.Errorf("invalid record: %s", err.Error())
+		}
+
+		parts = citationPartsFromRecord(&rec)
+	} else {
+		parts = make(citationParts)
+
+		for part, val := range raw {
+			var values []string
+			var value string
+
+			switch {
+			case json.Unmarshal(val, &values) == nil:
+				parts[part] = append(parts[part], values...)
+
+			case json.Unmarshal(val, &value) == nil:
+				parts[part] = append(parts[part], value)
+
+			default:
+				return nil, fmt.Errorf("invalid value for citation part: [%s]", part)
+			}
+		}
+	}
+
+	if len(parts) == 0 {
+		return nil, errors.New("record contains no citation parts")
+	}
+
+	return parts, nil
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/uvalib/virgo4-api/v4api"
+	"github.com/uvalib/virgo4-jwt/v4jwt"
+)
+
+// the pools known to the virgo pool registry (i.e. the interpool search service),
+// or to a local json file in the same format
+type poolRegistry struct {
+	mutex  sync.RWMutex
+	source string // registry url or file name
+	pools  []*poolRegistryEntry
+}
+
+type poolRegistryEntry struct {
+	id   string   // e.g. "uva_library"
+	name string   // e.g. "UVA Library"
+	url  string   // base url of the pool service
+	base *url.URL // the same, parsed, for matching item urls
+}
+
+func (r *poolRegistry) enabled() bool {
+	return r != nil && r.source != ""
+}
+
+func (r *poolRegistry) available() bool {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	return len(r.pools) > 0
+}
+
+func (r *poolRegistry) update(identities []v4api.PoolIdentity) {
+	var pools []*poolRegistryEntry
+
+	for _, identity := range identities {
+		if identity.ID == "" || identity.URL == "" {
+			continue
+		}
+
+		poolURL := strings.TrimSuffix(identity.URL, "/")
+
+		base, err := url.Parse(poolURL)
+		if err != nil || base.Host == "" {
+			log.Printf("[REGISTRY] WARNING: ignoring pool %s with invalid url [%s]", identity.ID, identity.URL)
+			continue
+		}
+
+		pools = append(pools, &poolRegistryEntry{
+			id:   identity.ID,
+			name: identity.Name,
+			url:  poolURL,
+			base: base,
+		})
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.pools = pools
+}
+
+// returns the pool an item url belongs to, if any
+func (r *poolRegistry) lookup(itemURL string) *poolRegistryEntry {
+	if r.enabled() == false || itemURL == "" {
+		return nil
+	}
+
+	u, err := url.Parse(itemURL)
+	if err != nil || u.Host == "" {
+		return nil
+	}
+
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	var match *poolRegistryEntry
+
+	// prefer the most specific base url, in case one pool's url is a prefix of another's
+	for _, pool := range r.pools {
+		if strings.EqualFold(u.Scheme, pool.base.Scheme) == false || strings.EqualFold(u.Host, pool.base.Host) == false {
+			continue
+		}
+
+		// items are below the base url, never the base url itself
+		if u.Path == pool.base.Path || pathHasPrefix(u.Path, pool.base.Path) == false {
+			continue
+		}
+
+		if match == nil || len(pool.base.Path) > len(match.base.Path) {
+			match = pool
+		}
+	}
+
+	return match
+}
+
+func (p *serviceContext) loadPoolIdentities() ([]v4api.PoolIdentity, error) {
+	var identities []v4api.PoolIdentity
+
+	cfg := p.config.Registry
+
+	if cfg.File != "" {
+		data, err := os.ReadFile(cfg.File)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := json.Unmarshal(data, &identities); err != nil {
+			return nil, err
+		}
+
+		return identities, nil
+	}
+
+	token, err := v4jwt.Mint(p.auth.claims, time.Duration(p.config.JWT.Expiration)*time.Minute, p.config.JWT.Key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to mint JWT: %s", err.Error())
+	}
+
+	req, err := http.NewRequest("GET", strings.TrimSuffix(cfg.URL, "/")+"/api/pools", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+
+	res, err := p.registryClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("received registry response code %d", res.StatusCode)
+	}
+
+	if err := json.NewDecoder(res.Body).Decode(&identities); err != nil {
+		return nil, err
+	}
+
+	return identities, nil
+}
+
+func (p *serviceContext) refreshPoolRegistry() {
+	identities, err := p.loadPoolIdentities()
+	if err != nil {
+		log.Printf("[REGISTRY] failed to load pools from %s: %s", p.registry.source, err.Error())
+		return
+	}
+
+	if len(identities) == 0 {
+		log.Printf("[REGISTRY] no pools found at %s; keeping previous pools", p.registry.source)
+		return
+	}
+
+	p.registry.update(identities)
+
+	for _, pool := range p.registry.pools {
+		log.Printf("[REGISTRY] pool %s (%s) = [%s]", pool.id, pool.name, pool.url)
+	}
+}
+
+func (p *serviceContext) initRegistry() {
+	cfg := p.config.Registry
+
+	p.registry = &poolRegistry{source: cfg.File}
+	if cfg.File == "" {
+		p.registry.source = cfg.URL
+	}
+
+	p.pools.allowlist.registry = p.registry
+
+	if p.registry.enabled() == false {
+		log.Printf("[REGISTRY] no pool registry configured")
+		return
+	}
+
+	connTimeout := integerWithMinimum(p.config.Pools.ConnTimeout, 1)
+	readTimeout := integerWithMinimum(p.config.Pools.ReadTimeout, 1)
+
+	p.registryClient = &http.Client{Timeout: time.Duration(connTimeout+readTimeout) * time.Second}
+
+	p.refreshPoolRegistry()
+
+	// a refresh interval of zero means the pools are only loaded at startup
+	refresh := integerWithMinimum(cfg.Refresh, 0)
+
+	log.Printf("[REGISTRY] source = [%s], refresh = %ds, item url = [%s]", p.registry.source, refresh, cfg.ItemURL)
+
+	if refresh > 0 {
+		go func() {
+			for range time.Tick(time.Duration(refresh) * time.Second) {
+				p.refreshPoolRegistry()
+			}
+		}()
+	}
+}
+
+func (s *citationsContext) checkPoolRegistry() serviceResponse {
+	if s.svc.registry.enabled() == false {
+		return serviceResponse{status: http.StatusOK}
+	}
+
+	if s.svc.registry.available() == false {
+		return serviceResponse{status: http.StatusServiceUnavailable, err: errors.New("pool registry is unavailable")}
+	}
+
+	if s.pool == nil {
+		return serviceResponse{status: http.StatusBadRequest, err: errors.New("invalid item url: url does not belong to a known pool")}
+	}
+
+	return serviceResponse{status: http.StatusOK}
+}
+
+// the public virgo url for an item, e.g. https://search.lib.virginia.edu/sources/{pool}/items/{id}
+func (p *serviceContext) itemURL(pool *poolRegistryEntry, id string) string {
+	if pool != nil && p.config.Registry.ItemURL != "" {
+		return strings.NewReplacer("{pool}", pool.id, "{id}", id).Replace(p.config.Registry.ItemURL)
+	}
+
+	if p.config.URLPrefix != "" {
+		return p.config.URLPrefix + id
+	}
+
+	return ""
+}
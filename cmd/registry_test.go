@@ -0,0 +1,52 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/uvalib/virgo4-api/v4api"
+)
+
+func TestPoolRegistryLookup(t *testing.T) {
+	registry := &poolRegistry{source: "test"}
+	registry.update([]v4api.PoolIdentity{
+		{ID: "solr", Name: "Catalog", URL: "https://pool-solr-ws.lib.virginia.edu/"},
+		{ID: "eds", Name: "Articles", URL: "https://api.example.com/pools/eds"},
+		{ID: "eds-plus", Name: "More Articles", URL: "https://api.example.com/pools/eds/plus"},
+		{ID: "broken", Name: "Broken", URL: "not a url"},
+	})
+
+	tests := []struct {
+		url  string
+		pool string
+	}{
+		{"https://pool-solr-ws.lib.virginia.edu/api/resource/u1", "solr"},
+		{"https://POOL-SOLR-WS.lib.virginia.edu/api/resource/u1", "solr"},
+		{"https://api.example.com/pools/eds/u1", "eds"},
+		{"https://api.example.com/pools/eds/plus/u1", "eds-plus"},
+
+		// not below a pool's base url
+		{"https://pool-solr-ws.lib.virginia.edu", ""},
+		{"https://api.example.com/pools/eds", ""},
+		{"https://api.example.com/pools/edsx/u1", ""},
+		{"https://pool-solr-ws.lib.virginia.edu.evil.com/api/resource/u1", ""},
+		{"https://pool-solr-ws.lib.virginia.edu@evil.com/api/resource/u1", ""},
+		{"http://api.example.com/pools/eds/u1", ""},
+
+		// dot segments, which could lead anywhere
+		{"https://api.example.com/pools/eds/../admin/x", ""},
+		{"https://api.example.com/pools/eds/%2e%2e/admin/x", ""},
+		{"https://api.example.com/pools/eds/plus/../../admin", ""},
+		{"", ""},
+	}
+
+	for _, test := range tests {
+		pool := ""
+		if entry := registry.lookup(test.url); entry != nil {
+			pool = entry.id
+		}
+
+		if pool != test.pool {
+			t.Errorf("lookup(%q) = %q, want %q", test.url, pool, test.pool)
+		}
+	}
+}
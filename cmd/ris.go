@@ -3,7 +3,6 @@ package main
 import (
 	"fmt"
 	"html"
-	"path"
 	"sort"
 	"strings"
 
@@ -109,6 +108,7 @@ func (e *risEncoder) Populate(parts citationParts) error {
 					risValue = risTypesMap[value]
 					if risValue == "" {
 						risValue = risTypeGeneric
+						metrics.fallbackFormat("ris")
 					}
 				} else {
 					if postfix != "" {
@@ -123,6 +123,7 @@ func (e *risEncoder) Populate(parts citationParts) error {
 
 	if len(e.tagValues[risTagType]) == 0 {
 		e.addTagValue(risTagType, risTypeGeneric)
+		metrics.fallbackFormat("ris")
 	}
 
 	// if present, move subtitle to the end of the title
@@ -160,7 +161,7 @@ func (e *risEncoder) ContentType() string {
 }
 
 func (e *risEncoder) FileName() string {
-	filename := path.Base(e.url)
+	filename := itemName(e.url)
 
 	if e.cfg.Extension != "" {
 		filename += "." + e.cfg.Extension
@@ -214,6 +215,11 @@ func (e *risEncoder) isLimitedLengthTag(tag string) bool {
 }
 
 func (e *risEncoder) cleanString(val string) string {
+	return cleanTaggedString(e.policy, val)
+}
+
+// cleans a value for inclusion in a plain-text tagged format such as RIS or Refer
+func cleanTaggedString(policy *bluemonday.Policy, val string) string {
 	cleaned := val
 
 	cleaned = strings.ReplaceAll(cleaned, `►`, `>`)
@@ -240,7 +246,7 @@ func (e *risEncoder) cleanString(val string) string {
 	cleaned = strings.ReplaceAll(cleaned, `«`, `"`)
 	cleaned = strings.ReplaceAll(cleaned, `»`, `"`)
 
-	cleaned = e.policy.Sanitize(cleaned)
+	cleaned = policy.Sanitize(cleaned)
 	cleaned = html.UnescapeString(cleaned)
 	cleaned = strings.TrimSpace(cleaned)
 
@@ -274,8 +280,10 @@ func (e *risEncoder) getTagValue(tag, val string) string {
 }
 
 func (e *risEncoder) Contents() (string, error) {
-	url := fmt.Sprintf(`<a href="%s">%s</a>`, e.url, e.url)
-	e.addTagValue(risTagNote, url)
+	if e.url != "" {
+		url := fmt.Sprintf(`<a href="%s">%s</a>`, e.url, e.url)
+		e.addTagValue(risTagNote, url)
+	}
 
 	tags := []string{}
 	for tag := range e.tagValues {
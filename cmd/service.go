@@ -3,13 +3,18 @@ package main
 import (
 	"fmt"
 	"log"
+	"log/slog"
 	"math/rand"
 	"net"
 	"net/http"
+	"os"
 	"path/filepath"
 	"runtime"
 	"strings"
 	"time"
+
+	"github.com/uvalib/virgo4-jwt/v4jwt"
+	"golang.org/x/sync/singleflight"
 )
 
 // git commit used for this build; supplied at compile time
@@ -22,14 +27,47 @@ type serviceVersion struct {
 }
 
 type servicePools struct {
-	client *http.Client
+	client      *http.Client
+	allowlist   *poolAllowlist
+	inflight    *singleflight.Group
+	breaker     *circuitBreaker
+	retries     int
+	backoffBase time.Duration
+	backoffMax  time.Duration
+}
+
+type serviceAuth struct {
+	anonymous string         // policy for callers without a token
+	claims    v4jwt.V4Claims // claims used on behalf of those callers
+}
+
+type serviceBatch struct {
+	maxItems int
+	workers  int
+}
+
+type serviceCache struct {
+	records *recordCache
+}
+
+type serviceCSL struct {
+	styles map[string]*cslStyle
 }
 
 type serviceContext struct {
-	randomSource *rand.Rand
-	config       *serviceConfig
-	version      serviceVersion
-	pools        servicePools
+	randomSource   *rand.Rand
+	logger         *slog.Logger
+	config         *serviceConfig
+	version        serviceVersion
+	auth           serviceAuth
+	pools          servicePools
+	registry       *poolRegistry
+	registryClient *http.Client
+	health         *healthProbes
+	batch          serviceBatch
+	cache          serviceCache
+	csl            serviceCSL
+	negotiation    []negotiableType
 }
 
 func (p *serviceContext) initVersion() {
@@ -51,6 +89,26 @@ func (p *serviceContext) initVersion() {
 }
 
 func (p *serviceContext) initPools() {
+	// allowed pools
+
+	allowlist, err := newPoolAllowlist(p.config.Pools.Allowed, p.config.Pools.AllowPrivate)
+	if err != nil {
+		log.Printf("error in pool allowlist: %s", err.Error())
+		os.Exit(1)
+	}
+
+	// pool requests carry a token, so they are never sent to just any host
+	if len(p.config.Pools.Allowed) == 0 {
+		if p.config.Registry.URL == "" && p.config.Registry.File == "" {
+			log.Printf("no pool allowlist or pool registry configured")
+			os.Exit(1)
+		}
+
+		log.Printf("[POOL] no pool allowlist configured; only pools in the pool registry will be requested")
+	}
+
+	log.Printf("[POOL] allowed = %v, allow private = %v", p.config.Pools.Allowed, p.config.Pools.AllowPrivate)
+
 	// client setup
 
 	connTimeout := integerWithMinimum(p.config.Pools.ConnTimeout, 1)
@@ -62,15 +120,85 @@ func (p *serviceContext) initPools() {
 			DialContext: (&net.Dialer{
 				Timeout:   time.Duration(connTimeout) * time.Second,
 				KeepAlive: 60 * time.Second,
+				Control:   allowlist.dialControl,
 			}).DialContext,
 			MaxIdleConns:        100, // we could be hitting one of a dozen or so pools,
 			MaxIdleConnsPerHost: 10,  // so spread out the idle connections among them
 			IdleConnTimeout:     90 * time.Second,
 		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			// redirects must stay within the allowed pools
+			if len(via) >= 10 {
+				return fmt.Errorf("stopped after 10 redirects")
+			}
+
+			if err := allowlist.check(req.URL.String()); err != nil {
+				return poolPolicyError{err}
+			}
+
+			return nil
+		},
 	}
 
+	// retry and circuit breaker setup; zero retries or a zero threshold disables them
+
+	retries := integerWithMinimum(p.config.Pools.Retries, 0)
+	backoffBase := integerWithMinimum(p.config.Pools.RetryBackoff, 50)
+	backoffMax := integerWithMinimum(p.config.Pools.RetryMaxBackoff, backoffBase)
+	threshold := integerWithMinimum(p.config.Pools.BreakerThreshold, 0)
+	cooldown := integerWithMinimum(p.config.Pools.BreakerCooldown, 1)
+
 	p.pools = servicePools{
-		client: poolsClient,
+		client:      poolsClient,
+		allowlist:   allowlist,
+		inflight:    &singleflight.Group{},
+		breaker:     newCircuitBreaker(threshold, time.Duration(cooldown)*time.Second),
+		retries:     retries,
+		backoffBase: time.Duration(backoffBase) * time.Millisecond,
+		backoffMax:  time.Duration(backoffMax) * time.Millisecond,
+	}
+
+	log.Printf("[POOL] retries = %d, backoff = %d-%d ms", retries, backoffBase, backoffMax)
+	log.Printf("[POOL] circuit breaker: threshold = %d, cooldown = %ds, enabled = %v", threshold, cooldown, p.pools.breaker.enabled())
+}
+
+func (p *servicePools) backoff(attempt int) time.Duration {
+	// exponential backoff, capped, with the upper half jittered so that
+	// callers that failed together do not all retry together
+	delay := p.backoffBase << attempt
+	if delay <= 0 || delay > p.backoffMax {
+		delay = p.backoffMax
+	}
+
+	half := delay / 2
+
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+func (p *serviceContext) initBatch() {
+	p.batch = serviceBatch{
+		maxItems: integerWithDefault(p.config.Batch.MaxItems, 1, 100),
+		workers:  integerWithDefault(p.config.Batch.Workers, 1, 8),
+	}
+
+	log.Printf("[BATCH] max items = %d, workers = %d", p.batch.maxItems, p.batch.workers)
+}
+
+func (p *serviceContext) initCache() {
+	// a size or ttl of zero disables caching
+	size := integerWithMinimum(p.config.Cache.Size, 0)
+	ttl := integerWithMinimum(p.config.Cache.TTL, 0)
+
+	p.cache = serviceCache{
+		records: newRecordCache(size, time.Duration(ttl)*time.Second),
+	}
+
+	log.Printf("[CACHE] pool records: size = %d, ttl = %ds, enabled = %v", size, ttl, p.cache.records.enabled())
+}
+
+func (p *serviceContext) initCSL() {
+	p.csl = serviceCSL{
+		styles: loadCSLStyles(p.config.CSL.StyleDir),
 	}
 }
 
@@ -80,8 +208,17 @@ func initializeService(cfg *serviceConfig) *serviceContext {
 	p.config = cfg
 	p.randomSource = rand.New(rand.NewSource(time.Now().UnixNano()))
 
+	p.initLogging()
 	p.initVersion()
+	p.initTracing()
+	p.initAuth()
 	p.initPools()
+	p.initRegistry()
+	p.initHealth()
+	p.initBatch()
+	p.initCache()
+	p.initCSL()
+	p.initNegotiation()
 
 	return &p
 }
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+)
+
+// a citation style that can be requested by name, for endpoints that are not style-specific
+type citationStyle struct {
+	json    bool // whether the style is served as json label/value pairs rather than as a file
+	concat  bool // whether multiple citations can be combined into a single file
+	encoder func(p *serviceContext, c *gin.Context) (citationType, error)
+}
+
+var citationStyles map[string]citationStyle
+
+func (p *serviceContext) cslEncoder(c *gin.Context) (citationType, error) {
+	id := c.Query("style")
+
+	style := p.csl.styles[id]
+	if style == nil {
+		return nil, fmt.Errorf("unknown citation style: [%s]", id)
+	}
+
+	return newCSLEncoder(p.config.Formats.CSL, style, true), nil
+}
+
+func (p *serviceContext) dcEncoder(c *gin.Context) (citationType, error) {
+	asJSON, ok := dcOutputIsJSON(c.Query("as"))
+	if ok == false {
+		return nil, fmt.Errorf("unsupported dublin core output: [%s]", c.Query("as"))
+	}
+
+	cfg := p.config.Formats.DC
+	if asJSON == true {
+		cfg = p.config.Formats.DCJSON
+	}
+
+	return newDcEncoder(cfg, asJSON), nil
+}
+
+func init() {
+	// styles are named after their /format endpoints
+	citationStyles = make(map[string]citationStyle)
+
+	citationStyles["apa"] = citationStyle{json: true, encoder: func(p *serviceContext, c *gin.Context) (citationType, error) {
+		return newApaEncoder(p.config.Formats.APA, true), nil
+	}}
+
+	citationStyles["biblatex"] = citationStyle{concat: true, encoder: func(p *serviceContext, c *gin.Context) (citationType, error) {
+		return newBiblatexEncoder(p.config.Formats.BibLaTeX), nil
+	}}
+
+	citationStyles["bibtex"] = citationStyle{concat: true, encoder: func(p *serviceContext, c *gin.Context) (citationType, error) {
+		return newBibtexEncoder(p.config.Formats.BibTeX), nil
+	}}
+
+	citationStyles["citeas"] = citationStyle{json: true, encoder: func(p *serviceContext, c *gin.Context) (citationType, error) {
+		return newCiteAsEncoder(p.config.Formats.CiteAs), nil
+	}}
+
+	citationStyles["cms"] = citationStyle{json: true, encoder: func(p *serviceContext, c *gin.Context) (citationType, error) {
+		return newCmsEncoder(p.config.Formats.CMS, true), nil
+	}}
+
+	citationStyles["coins"] = citationStyle{encoder: func(p *serviceContext, c *gin.Context) (citationType, error) {
+		return newCoinsEncoder(p.config.Formats.COinS, p.config.OpenURL.ReferrerID), nil
+	}}
+
+	citationStyles["csl"] = citationStyle{json: true, encoder: func(p *serviceContext, c *gin.Context) (citationType, error) {
+		return p.cslEncoder(c)
+	}}
+
+	citationStyles["csl-json"] = citationStyle{encoder: func(p *serviceContext, c *gin.Context) (citationType, error) {
+		return newCSLJSONEncoder(p.config.Formats.CSLJSON), nil
+	}}
+
+	citationStyles["dc"] = citationStyle{encoder: func(p *serviceContext, c *gin.Context) (citationType, error) {
+		return p.dcEncoder(c)
+	}}
+
+	citationStyles["endnote"] = citationStyle{encoder: func(p *serviceContext, c *gin.Context) (citationType, error) {
+		return newEndnoteXmlEncoder(p.config.Formats.EndNote), nil
+	}}
+
+	citationStyles["enw"] = citationStyle{concat: true, encoder: func(p *serviceContext, c *gin.Context) (citationType, error) {
+		return newEnwEncoder(p.config.Formats.Enw), nil
+	}}
+
+	citationStyles["jsonld"] = citationStyle{encoder: func(p *serviceContext, c *gin.Context) (citationType, error) {
+		return newJSONLDEncoder(p.config.Formats.JSONLD), nil
+	}}
+
+	citationStyles["lbb"] = citationStyle{json: true, encoder: func(p *serviceContext, c *gin.Context) (citationType, error) {
+		return newLbbEncoder(p.config.Formats.LBB, true), nil
+	}}
+
+	citationStyles["mla"] = citationStyle{json: true, encoder: func(p *serviceContext, c *gin.Context) (citationType, error) {
+		return newMlaEncoder(p.config.Formats.MLA, true), nil
+	}}
+
+	citationStyles["mods"] = citationStyle{encoder: func(p *serviceContext, c *gin.Context) (citationType, error) {
+		return newModsEncoder(p.config.Formats.MODS), nil
+	}}
+
+	citationStyles["openurl"] = citationStyle{json: true, encoder: func(p *serviceContext, c *gin.Context) (citationType, error) {
+		return newOpenURLEncoder(p.config.Formats.OpenURL, "", p.config.OpenURL.ReferrerID), nil
+	}}
+
+	citationStyles["ris"] = citationStyle{concat: true, encoder: func(p *serviceContext, c *gin.Context) (citationType, error) {
+		return newRisEncoder(p.config.Formats.RIS), nil
+	}}
+}
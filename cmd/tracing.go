@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// trace exporters
+const (
+	traceExporterNone   = ""
+	traceExporterOTLP   = "otlp"
+	traceExporterStdout = "stdout"
+)
+
+const tracerName = "github.com/uvalib/virgo4-citations-ws"
+
+// until tracing is configured, this hands out spans that are not recorded
+var tracer = otel.Tracer(tracerName)
+
+func (p *serviceContext) initTracing() {
+	// always pass trace context along to pools, even when not recording our own spans
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var opt sdktrace.TracerProviderOption
+
+	switch p.config.Tracing.Exporter {
+	case traceExporterNone:
+		log.Printf("[TRACING] disabled")
+		return
+
+	case traceExporterOTLP:
+		// the endpoint (and everything else) can also be set with the standard OTEL_EXPORTER_OTLP_* variables
+		var opts []otlptracehttp.Option
+		if p.config.Tracing.Endpoint != "" {
+			opts = append(opts, otlptracehttp.WithEndpointURL(p.config.Tracing.Endpoint))
+		}
+
+		exporter, err := otlptracehttp.New(context.Background(), opts...)
+		if err != nil {
+			log.Printf("failed to create otlp trace exporter: %s", err.Error())
+			os.Exit(1)
+		}
+
+		opt = sdktrace.WithBatcher(exporter)
+
+	case traceExporterStdout:
+		// for local verification; spans are written as soon as they end
+		exporter, err := stdouttrace.New(stdouttrace.WithPrettyPrint())
+		if err != nil {
+			log.Printf("failed to create stdout trace exporter: %s", err.Error())
+			os.Exit(1)
+		}
+
+		opt = sdktrace.WithSyncer(exporter)
+
+	default:
+		log.Printf("invalid trace exporter: [%s]", p.config.Tracing.Exporter)
+		os.Exit(1)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(
+		attribute.String("service.name", "virgo4-citations-ws"),
+		attribute.String("service.version", p.version.BuildVersion),
+	))
+	if err != nil {
+		log.Printf("failed to create trace resource: %s", err.Error())
+		os.Exit(1)
+	}
+
+	// sampling follows the standard OTEL_TRACES_SAMPLER variables
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(opt, sdktrace.WithResource(res)))
+
+	log.Printf("[TRACING] exporter = %s, endpoint = [%s]", p.config.Tracing.Exporter, p.config.Tracing.Endpoint)
+}
+
+func (c *clientContext) initTrace() {
+	// continue the caller's trace, if any
+	c.ctx = otel.GetTextMapPropagator().Extract(c.ginCtx.Request.Context(), propagation.HeaderCarrier(c.ginCtx.Request.Header))
+}
+
+func (s *citationsContext) startSpan(name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	ctx := s.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	return tracer.Start(ctx, name, opts...)
+}
+
+func injectTrace(ctx context.Context, req *http.Request) {
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+}
+
+func endSpan(span trace.Span, status int, err error) {
+	if status != 0 {
+		span.SetAttributes(attribute.Int("http.response.status_code", status))
+	}
+
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	span.End()
+}
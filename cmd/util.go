@@ -1,7 +1,11 @@
 package main
 
 import (
+	"html"
 	"strconv"
+	"strings"
+
+	"github.com/microcosm-cc/bluemonday"
 )
 
 // miscellaneous utility functions
@@ -17,6 +21,15 @@ func integerWithMinimum(str string, min int) int {
 	return val
 }
 
+func integerWithDefault(str string, min, def int) int {
+	// fallback for unset values
+	if str == "" {
+		return def
+	}
+
+	return integerWithMinimum(str, min)
+}
+
 func firstElementOf(s []string) string {
 	// return first element of slice, or blank string if empty
 	val := ""
@@ -60,3 +73,12 @@ func removeEntries(haystack []string, needles []string) []string {
 
 	return res
 }
+
+func plainText(policy *bluemonday.Policy, s string) string {
+	// strip any markup and entities, and collapse whitespace
+	cleaned := policy.Sanitize(s)
+	cleaned = html.UnescapeString(cleaned)
+	cleaned = strings.Join(strings.Fields(cleaned), " ")
+
+	return cleaned
+}